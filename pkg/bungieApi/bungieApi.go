@@ -1,9 +1,11 @@
 package bungieAPI
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -18,60 +20,255 @@ import (
 
 var (
 	ACTIVITIES_PAGE_SIZE = 250
-	httpClient           = http.Client{
-		Timeout: time.Second * 15,
-	}
+	// How many pages of activity history to request ahead of the page being filtered
+	ACTIVITIES_PREFETCH_PAGES = 2
+	DEFAULT_BASE_URL          = "https://www.bungie.net"
+	DEFAULT_STATS_URL         = "https://stats.bungie.net"
+	DEFAULT_TIMEOUT           = time.Second * 15
+	// Definition tables can be hundreds of megabytes, and the timeout includes reading the body
+	DEFAULT_DEFINITION_TIMEOUT = time.Minute * 5
+	// How long a membership's resolved cross save primary membership is reused for
+	PRIMARY_MEMBERSHIP_CACHE_TTL = time.Hour
 )
 
 type BungieAPI struct {
-	apiKey string
+	apiKey       string
+	limiter      *rateLimiter
+	baseURL      string
+	statsBaseURL string
+	timeout      time.Duration
+	// Timeout for downloading definition tables, rather than API requests
+	definitionTimeout    time.Duration
+	proxyURL             *url.URL
+	transport            http.RoundTripper
+	httpClient           *http.Client
+	definitionHTTPClient *http.Client
+	definitions          *definitionStore
+	diskCache            *definitionDiskCache
+	primaryMemberships   *primaryMembershipCache
+	locale               string
+}
+
+// Option configures optional behaviour of a BungieAPI client in Create.
+type Option func(*BungieAPI)
+
+// WithBaseURL sends requests to a host other than www.bungie.net. It also replaces
+// the stats.bungie.net host unless WithStatsBaseURL is given after it.
+func WithBaseURL(baseURL string) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.baseURL = strings.TrimSuffix(baseURL, "/")
+		bungieAPI.statsBaseURL = bungieAPI.baseURL
+	}
+}
+
+// WithStatsBaseURL sends stats requests, such as PGCRs, to a host other than stats.bungie.net.
+func WithStatsBaseURL(statsBaseURL string) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.statsBaseURL = strings.TrimSuffix(statsBaseURL, "/")
+	}
+}
+
+// WithTimeout sets the timeout for each individual HTTP request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.timeout = timeout
+	}
+}
+
+// WithDefinitionTimeout sets the timeout for downloading each definition table, which is
+// separate from WithTimeout because the tables are much larger than API responses.
+func WithDefinitionTimeout(timeout time.Duration) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.definitionTimeout = timeout
+	}
+}
+
+// WithProxy sends all requests through the HTTP proxy.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.proxyURL = proxyURL
+	}
+}
+
+// WithTransport makes requests with the RoundTripper instead of http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.transport = transport
+	}
+}
+
+// WithCacheDir saves downloaded definition tables to the directory, so they're only
+// downloaded again when Bungie releases a new manifest version.
+func WithCacheDir(dir string) Option {
+	return func(bungieAPI *BungieAPI) {
+		if dir == "" {
+			bungieAPI.diskCache = nil
+			return
+		}
+
+		bungieAPI.diskCache = newDefinitionDiskCache(dir)
+	}
+}
+
+// WithLocale looks up definitions in the locale rather than English.
+func WithLocale(locale string) Option {
+	return func(bungieAPI *BungieAPI) {
+		bungieAPI.locale = locale
+	}
 }
 
-func Create(apiKey string) BungieAPI {
+func Create(apiKey string, options ...Option) BungieAPI {
 	newInstance := BungieAPI{
-		apiKey: apiKey,
+		apiKey:             apiKey,
+		limiter:            rateLimiterForKey(apiKey),
+		baseURL:            DEFAULT_BASE_URL,
+		statsBaseURL:       DEFAULT_STATS_URL,
+		timeout:            DEFAULT_TIMEOUT,
+		definitionTimeout:  DEFAULT_DEFINITION_TIMEOUT,
+		definitions:        newDefinitionStore(),
+		primaryMemberships: newPrimaryMembershipCache(),
+		locale:             DEFAULT_LOCALE,
+	}
+
+	for _, option := range options {
+		option(&newInstance)
+	}
+
+	transport := newInstance.transport
+	if newInstance.proxyURL != nil {
+		baseTransport, ok := transport.(*http.Transport)
+		if transport == nil {
+			baseTransport, ok = http.DefaultTransport.(*http.Transport)
+		}
+
+		if ok {
+			proxiedTransport := baseTransport.Clone()
+			proxiedTransport.Proxy = http.ProxyURL(newInstance.proxyURL)
+			transport = proxiedTransport
+		} else {
+			backend.Logger.Warn("Ignoring proxy because a custom transport was provided")
+		}
+	}
+
+	newInstance.httpClient = &http.Client{
+		Timeout:   newInstance.timeout,
+		Transport: transport,
+	}
+
+	newInstance.definitionHTTPClient = &http.Client{
+		Timeout:   newInstance.definitionTimeout,
+		Transport: transport,
 	}
 
 	return newInstance
 }
 
-func (bungieAPI BungieAPI) Get(path string, query url.Values) ([]byte, error) {
-	requestUrl := path
-	if !strings.Contains(requestUrl, "https://") {
-		requestUrl = fmt.Sprintf("https://www.bungie.net%v", requestUrl)
-	}
+// Get requests the URL, waiting on the API key's rate limiter first, and retries transient
+// Bungie failures with backoff. Unsuccessful responses are returned as a *BungieError.
+func (bungieAPI BungieAPI) Get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	return bungieAPI.request(ctx, bungieAPI.httpClient, http.MethodGet, path, query, nil)
+}
 
-	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+// Post sends requestBody as JSON, with the same rate limiting, retries and errors as Get.
+func (bungieAPI BungieAPI) Post(ctx context.Context, path string, requestBody any) ([]byte, error) {
+	body, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, err
 	}
 
+	return bungieAPI.request(ctx, bungieAPI.httpClient, http.MethodPost, path, nil, body)
+}
+
+func (bungieAPI BungieAPI) request(ctx context.Context, httpClient *http.Client, method string, path string, query url.Values, requestBody []byte) ([]byte, error) {
+	requestUrl := path
+	if !strings.HasPrefix(requestUrl, "https://") && !strings.HasPrefix(requestUrl, "http://") {
+		requestUrl = fmt.Sprintf("%v%v", bungieAPI.baseURL, requestUrl)
+	}
+
 	if query == nil {
 		query = url.Values{}
 	}
 
+	// Definition tables are huge and aren't wrapped in the platform response envelope,
+	// so only /Platform/ responses are inspected for error codes
+	isPlatformRequest := strings.Contains(requestUrl, "/Platform/")
+
+	for attempt := 0; ; attempt++ {
+		body, statusCode, err := bungieAPI.doRequest(ctx, httpClient, method, requestUrl, query, requestBody)
+		if err != nil {
+			return nil, err
+		}
+
+		envelope := DestinyResponse[json.RawMessage]{}
+		if isPlatformRequest {
+			// Bodies that aren't valid JSON are left for the caller to report
+			_ = json.Unmarshal(body, &envelope)
+		}
+
+		if envelope.ThrottleSeconds > 0 && bungieAPI.limiter != nil {
+			bungieAPI.limiter.PauseFor(time.Second * time.Duration(envelope.ThrottleSeconds))
+		}
+
+		retryable := isRetryableStatusCode(statusCode) || isRetryableErrorCode(envelope.ErrorCode)
+		if !retryable || attempt >= MAX_RETRIES {
+			if err := responseError(statusCode, envelope); err != nil {
+				return nil, err
+			}
+
+			return body, nil
+		}
+
+		delay := retryDelay(attempt, envelope.ThrottleSeconds)
+		backend.Logger.Warn("Retrying Bungie request", "url", requestUrl, "statusCode", statusCode, "errorStatus", envelope.ErrorStatus, "attempt", attempt+1, "delay", delay)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (bungieAPI BungieAPI) doRequest(ctx context.Context, httpClient *http.Client, method string, requestUrl string, query url.Values, requestBody []byte) ([]byte, int, error) {
+	if bungieAPI.limiter != nil {
+		if err := bungieAPI.limiter.Wait(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var bodyReader io.Reader
+	if requestBody != nil {
+		bodyReader = bytes.NewReader(requestBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, bodyReader)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	query.Set("_cacheBust", strconv.Itoa(int(time.Now().Unix())))
 	req.URL.RawQuery = query.Encode()
 
-	backend.Logger.Debug("Requesting URL", "url", req.URL.String())
+	backend.Logger.Debug("Requesting URL", "method", method, "url", req.URL.String())
 
 	req.Header.Set("x-api-key", bungieAPI.apiKey)
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	res, getErr := httpClient.Do(req)
 	if getErr != nil {
-		return nil, getErr
+		return nil, 0, getErr
 	}
 	defer res.Body.Close()
 
 	body, readErr := ioutil.ReadAll(res.Body)
 	if readErr != nil {
-		return nil, readErr
+		return nil, 0, readErr
 	}
 
-	return body, nil
+	return body, res.StatusCode, nil
 }
 
-func (bungieAPI BungieAPI) RequestCharacterActivityHistory(membershipType int, membershipID string, characterID string, modeType int, page int) ([]bungie.DestinyHistoricalStatsPeriodGroup, error) {
+func (bungieAPI BungieAPI) RequestCharacterActivityHistory(ctx context.Context, membershipType int, membershipID string, characterID string, modeType int, page int) ([]bungie.DestinyHistoricalStatsPeriodGroup, error) {
 	query := url.Values{}
 	query.Add("page", strconv.Itoa(page))
 	query.Add("count", strconv.Itoa(ACTIVITIES_PAGE_SIZE))
@@ -80,7 +277,7 @@ func (bungieAPI BungieAPI) RequestCharacterActivityHistory(membershipType int, m
 	}
 
 	path := fmt.Sprintf("/Platform/Destiny2/%v/Account/%v/Character/%v/Stats/Activities/", membershipType, membershipID, characterID)
-	body, err := bungieAPI.Get(path, query)
+	body, err := bungieAPI.Get(ctx, path, query)
 	if err != nil {
 		return nil, err
 	}
@@ -94,24 +291,54 @@ func (bungieAPI BungieAPI) RequestCharacterActivityHistory(membershipType int, m
 	return activityHistory.Response.Activities, nil
 }
 
-func (bungieAPI BungieAPI) RequestCharacterActivityHistoryForRange(membershipType int, membershipID string, characterID string, modeType int, timeRange backend.TimeRange) ([]bungie.DestinyHistoricalStatsPeriodGroup, error) {
-	activities := []bungie.DestinyHistoricalStatsPeriodGroup{}
-	running := true
-	page := 0
+type activityHistoryPage struct {
+	activities []bungie.DestinyHistoricalStatsPeriodGroup
+	err        error
+}
 
-	for running {
-		activitiesPage, err := bungieAPI.RequestCharacterActivityHistory(membershipType, membershipID, characterID, modeType, page)
-		if err != nil {
-			return nil, err
+// RequestCharacterActivityHistoryForRange pages through the character's activity history, newest first,
+// until it reaches an activity that started before timeRange.From. Upcoming pages are prefetched
+// while earlier ones are being filtered, but only while the latest page still ends within the range.
+func (bungieAPI BungieAPI) RequestCharacterActivityHistoryForRange(ctx context.Context, membershipType int, membershipID string, characterID string, modeType int, timeRange backend.TimeRange) ([]bungie.DestinyHistoricalStatsPeriodGroup, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make(chan activityHistoryPage, ACTIVITIES_PREFETCH_PAGES)
+
+	go func() {
+		defer close(pages)
+
+		for page := 0; ; page++ {
+			activitiesPage, err := bungieAPI.RequestCharacterActivityHistory(ctx, membershipType, membershipID, characterID, modeType, page)
+
+			select {
+			case pages <- activityHistoryPage{activities: activitiesPage, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil || len(activitiesPage) == 0 {
+				return
+			}
+
+			// Pages are newest first, so nothing on the next page can be within the range either
+			if activitiesPage[len(activitiesPage)-1].Period.Before(timeRange.From) {
+				return
+			}
 		}
+	}()
 
-		page += 1
+	activities := []bungie.DestinyHistoricalStatsPeriodGroup{}
+
+	for activitiesPage := range pages {
+		if activitiesPage.err != nil {
+			return nil, activitiesPage.err
+		}
 
-		for _, activity := range activitiesPage {
+		for _, activity := range activitiesPage.activities {
 			activityStart := activity.Period
 			if activityStart.Before(timeRange.From) {
-				running = false
-				break
+				return activities, nil
 			}
 
 			if activityStart.After(timeRange.To) {
@@ -125,8 +352,90 @@ func (bungieAPI BungieAPI) RequestCharacterActivityHistoryForRange(membershipTyp
 	return activities, nil
 }
 
-func (bungieAPI BungieAPI) RequestManifest() (*bungie.DestinyManifest, error) {
-	body, err := bungieAPI.Get("/Platform/Destiny2/Manifest/", nil)
+func (bungieAPI BungieAPI) RequestPostGameCarnageReport(ctx context.Context, instanceID int64) (*bungie.DestinyPostGameCarnageReportData, error) {
+	path := fmt.Sprintf("%v/Platform/Destiny2/Stats/PostGameCarnageReport/%v/", bungieAPI.statsBaseURL, instanceID)
+	body, err := bungieAPI.Get(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.DestinyPostGameCarnageReportData]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return &resp.Response, nil
+}
+
+// RequestAccountStats requests the lifetime stats of the account, merged across every character
+// including deleted ones, for the allPvE and allPvP mode groups.
+func (bungieAPI BungieAPI) RequestAccountStats(ctx context.Context, membershipType int, membershipID string) (*bungie.DestinyHistoricalStatsAccountResult, error) {
+	path := fmt.Sprintf("/Platform/Destiny2/%v/Account/%v/Stats/", membershipType, membershipID)
+	body, err := bungieAPI.Get(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.DestinyHistoricalStatsAccountResult]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return &resp.Response, nil
+}
+
+// RequestCharacterStats requests historical stats for the character by activity mode, keyed by the
+// mode's friendly name. characterID "0" returns stats for all of the account's characters. dayStart
+// and dayEnd are only used for daily stats, and may be at most 31 days apart.
+func (bungieAPI BungieAPI) RequestCharacterStats(ctx context.Context, membershipType int, membershipID string, characterID string, modes []int, periodType int, dayStart time.Time, dayEnd time.Time) (map[string]bungie.DestinyHistoricalStatsByPeriod, error) {
+	modeStrings := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		modeStrings = append(modeStrings, strconv.Itoa(mode))
+	}
+
+	query := url.Values{}
+	query.Add("modes", strings.Join(modeStrings, ","))
+	query.Add("periodType", strconv.Itoa(periodType))
+	if periodType == bungie.PeriodTypeDaily {
+		query.Add("daystart", dayStart.Format(time.RFC3339))
+		query.Add("dayend", dayEnd.Format(time.RFC3339))
+	}
+
+	path := fmt.Sprintf("/Platform/Destiny2/%v/Account/%v/Character/%v/Stats/", membershipType, membershipID, characterID)
+	body, err := bungieAPI.Get(ctx, path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[map[string]bungie.DestinyHistoricalStatsByPeriod]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return resp.Response, nil
+}
+
+func (bungieAPI BungieAPI) RequestUniqueWeaponStats(ctx context.Context, membershipType int, membershipID string, characterID string) ([]bungie.DestinyHistoricalWeaponStats, error) {
+	path := fmt.Sprintf("/Platform/Destiny2/%v/Account/%v/Character/%v/Stats/UniqueWeapons/", membershipType, membershipID, characterID)
+	body, err := bungieAPI.Get(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.DestinyHistoricalWeaponStatsData]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return resp.Response.Weapons, nil
+}
+
+func (bungieAPI BungieAPI) RequestManifest(ctx context.Context) (*bungie.DestinyManifest, error) {
+	body, err := bungieAPI.Get(ctx, "/Platform/Destiny2/Manifest/", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -140,8 +449,8 @@ func (bungieAPI BungieAPI) RequestManifest() (*bungie.DestinyManifest, error) {
 	return &data.Response, nil
 }
 
-func (bungieAPI BungieAPI) RequestSettings() (*bungie.Destiny2CoreSettings, error) {
-	body, err := bungieAPI.Get("/Platform/Settings/", nil)
+func (bungieAPI BungieAPI) RequestSettings(ctx context.Context) (*bungie.Destiny2CoreSettings, error) {
+	body, err := bungieAPI.Get(ctx, "/Platform/Settings/", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -155,25 +464,37 @@ func (bungieAPI BungieAPI) RequestSettings() (*bungie.Destiny2CoreSettings, erro
 	return &data.Response, nil
 }
 
-func (bungieAPI BungieAPI) RequestDefinitionTable(tableName string) ([]byte, error) {
-	manifest, err := bungieAPI.RequestManifest()
+func (bungieAPI BungieAPI) RequestDefinitionTable(ctx context.Context, tableName string) ([]byte, error) {
+	manifest, err := bungieAPI.RequestManifest(ctx)
 	if err != nil {
 		log.Error("Unable to get manifest")
 		return nil, err
 	}
 
-	definitionUrl := manifest.JsonWorldComponentContentPaths["en"][tableName]
-	return bungieAPI.Get(definitionUrl, nil)
+	return bungieAPI.requestDefinitionTableForManifest(ctx, manifest, bungieAPI.locale, tableName)
+}
+
+func (bungieAPI BungieAPI) requestDefinitionTableForManifest(ctx context.Context, manifest *bungie.DestinyManifest, locale string, tableName string) ([]byte, error) {
+	definitionUrl, ok := manifest.JsonWorldComponentContentPaths[locale][tableName]
+	if !ok {
+		return nil, fmt.Errorf("manifest %v has no %v table for locale %v", manifest.Version, tableName, locale)
+	}
+
+	return bungieAPI.request(ctx, bungieAPI.definitionHTTPClient, http.MethodGet, definitionUrl, nil, nil)
 }
 
-func (bungieAPI BungieAPI) RequestProfileRaw(membershipType int, membershipID string, components []int) (*DestinyResponse[bungie.DestinyProfileResponse], error) {
+func (bungieAPI BungieAPI) requestProfileBody(ctx context.Context, membershipType int, membershipID string, components []int) ([]byte, error) {
 	query := url.Values{}
 	for _, component := range components {
 		query.Add("components", strconv.Itoa(component))
 	}
 
 	path := fmt.Sprintf("/Platform/Destiny2/%v/Profile/%v/", membershipType, membershipID)
-	body, err := bungieAPI.Get(path, query)
+	return bungieAPI.Get(ctx, path, query)
+}
+
+func (bungieAPI BungieAPI) RequestProfileRaw(ctx context.Context, membershipType int, membershipID string, components []int) (*DestinyResponse[bungie.DestinyProfileResponse], error) {
+	body, err := bungieAPI.requestProfileBody(ctx, membershipType, membershipID, components)
 	if err != nil {
 		return nil, err
 	}
@@ -184,16 +505,11 @@ func (bungieAPI BungieAPI) RequestProfileRaw(membershipType int, membershipID st
 		return nil, jsonErr
 	}
 
-	if resp.ErrorStatus != "Success" {
-		errorString := resp.ErrorStatus + ": " + resp.Message
-		return nil, errors.New(errorString)
-	}
-
 	return &resp, nil
 }
 
-func (bungieAPI BungieAPI) RequestProfile(membershipType int, membershipID string, components []int) (*bungie.DestinyProfileResponse, error) {
-	resp, err := bungieAPI.RequestProfileRaw(membershipType, membershipID, components)
+func (bungieAPI BungieAPI) RequestProfile(ctx context.Context, membershipType int, membershipID string, components []int) (*bungie.DestinyProfileResponse, error) {
+	resp, err := bungieAPI.RequestProfileRaw(ctx, membershipType, membershipID, components)
 
 	if err != nil {
 		return nil, err
@@ -202,6 +518,31 @@ func (bungieAPI BungieAPI) RequestProfile(membershipType int, membershipID strin
 	return &resp.Response, nil
 }
 
+// RequestProfileWithGuardianRank requests the profile like RequestProfile, also decoding the Guardian
+// Rank the profile models don't include. The Guardian Rank is only set when the profiles component
+// is requested.
+func (bungieAPI BungieAPI) RequestProfileWithGuardianRank(ctx context.Context, membershipType int, membershipID string, components []int) (*bungie.DestinyProfileResponse, *GuardianRank, error) {
+	body, err := bungieAPI.requestProfileBody(ctx, membershipType, membershipID, components)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp := DestinyResponse[profileWithGuardianRankResponse]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, nil, jsonErr
+	}
+
+	profile := resp.Response.DestinyProfileResponse
+	profile.Profile = bungie.SingleComponentResponseOfDestinyProfileComponent{
+		Data:     resp.Response.Profile.Data.DestinyProfileComponent,
+		Privacy:  resp.Response.Profile.Privacy,
+		Disabled: resp.Response.Profile.Disabled,
+	}
+
+	return &profile, &resp.Response.Profile.Data.GuardianRank, nil
+}
+
 func (bungieAPI BungieAPI) GetClassTypeName(classType bungie.DestinyClass) string {
 	switch classType {
 	case bungie.DestinyClassHunter:
@@ -217,9 +558,53 @@ func (bungieAPI BungieAPI) GetClassTypeName(classType bungie.DestinyClass) strin
 	}
 }
 
-func (bungieAPI BungieAPI) RequestCharacterDescriptions(membershipType int, membershipID string) ([]ListCharactersResourceResponseItem, error) {
+func (bungieAPI BungieAPI) GetRaceTypeName(raceType bungie.DestinyRace) string {
+	switch raceType {
+	case bungie.DestinyRaceHuman:
+		return "Human"
+	case bungie.DestinyRaceAwoken:
+		return "Awoken"
+	case bungie.DestinyRaceExo:
+		return "Exo"
+	case bungie.DestinyRaceUnknown:
+		fallthrough
+	default:
+		return "Unknown"
+	}
+}
+
+// ImageURL returns the full URL of an image path from the API, such as an emblem or icon.
+// Images are always served from www.bungie.net, even when requests go through another host.
+func ImageURL(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	return DEFAULT_BASE_URL + path
+}
+
+func (bungieAPI BungieAPI) GetMembershipTypeName(membershipType int) string {
+	switch membershipType {
+	case bungie.BungieMembershipTypeTigerXbox:
+		return "Xbox"
+	case bungie.BungieMembershipTypeTigerPsn:
+		return "PlayStation"
+	case bungie.BungieMembershipTypeTigerSteam:
+		return "Steam"
+	case bungie.BungieMembershipTypeTigerBlizzard:
+		return "Battle.net"
+	case bungie.BungieMembershipTypeTigerStadia:
+		return "Stadia"
+	case bungie.BungieMembershipTypeTigerDemon:
+		return "Epic Games"
+	default:
+		return "Unknown"
+	}
+}
+
+func (bungieAPI BungieAPI) RequestCharacterDescriptions(ctx context.Context, membershipType int, membershipID string) ([]ListCharactersResourceResponseItem, error) {
 	components := []int{bungie.DestinyComponentTypeCharacters}
-	profile, err := bungieAPI.RequestProfile(membershipType, membershipID, components)
+	profile, err := bungieAPI.RequestProfile(ctx, membershipType, membershipID, components)
 	if err != nil {
 		backend.Logger.Error("Error requesting profile", "error", err, "membershipId", membershipID)
 		return nil, err
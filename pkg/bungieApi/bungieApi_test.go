@@ -0,0 +1,205 @@
+package bungieAPI
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestGetRetriesThrottledRequests(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("expected API key header, got %q", r.Header.Get("x-api-key"))
+		}
+
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write([]byte(`{ "ErrorCode": 36, "ErrorStatus": "ThrottleLimitExceededMomentarily", "Message": "Slow down" }`))
+			return
+		}
+
+		w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": "test-version" } }`))
+	}))
+	defer server.Close()
+
+	originalDelay := RETRY_BASE_DELAY
+	RETRY_BASE_DELAY = time.Millisecond
+	defer func() { RETRY_BASE_DELAY = originalDelay }()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	manifest, err := client.RequestManifest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Version != "test-version" {
+		t.Errorf("expected manifest version from test server, got %q", manifest.Version)
+	}
+
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("expected throttled request to be retried once, got %v requests", requests)
+	}
+}
+
+func TestRequestCharacterActivityHistoryPrivacyRestricted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "ErrorCode": 1665, "ErrorStatus": "DestinyPrivacyRestriction", "Message": "This user has chosen to keep their game history private." }`))
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	_, err := client.RequestCharacterActivityHistory(context.Background(), 2, "1", "2", 0, 0)
+	if !errors.Is(err, ErrPrivacyRestricted) {
+		t.Errorf("expected ErrPrivacyRestricted, got %v", err)
+	}
+}
+
+func TestRequestCharacterActivityHistoryForRangeStopsAtRangeStart(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		var period time.Time
+		switch r.URL.Query().Get("page") {
+		case "0":
+			period = now.Add(-time.Hour)
+		case "1":
+			period = now.Add(-time.Hour * 48)
+		default:
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": {} }`))
+			return
+		}
+
+		fmt.Fprintf(w, `{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "activities": [{ "period": %q }] } }`, period.Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+	timeRange := backend.TimeRange{From: now.Add(-time.Hour * 24), To: now}
+
+	activities, err := client.RequestCharacterActivityHistoryForRange(context.Background(), 2, "1", "2", 0, timeRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(activities) != 1 {
+		t.Errorf("expected only the activity within the time range, got %v", len(activities))
+	}
+
+	// The second page already ends before the range, so no further pages are prefetched
+	if requests := atomic.LoadInt32(&requests); requests != 2 {
+		t.Errorf("expected only the pages overlapping the time range to be requested, got %v requests", requests)
+	}
+}
+
+func TestSearchProfilesExactNameUsesCrossSaveMembership(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected exact search to be a POST, got %v", r.Method)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"displayName":"Guardian","displayNameCode":42}` {
+			t.Errorf("unexpected search body %s", body)
+		}
+
+		w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": [
+			{ "membershipType": 1, "membershipId": "100", "crossSaveOverride": 3, "displayName": "Xbox", "bungieGlobalDisplayName": "Guardian", "bungieGlobalDisplayNameCode": 42 },
+			{ "membershipType": 3, "membershipId": "300", "crossSaveOverride": 3, "displayName": "Steam", "bungieGlobalDisplayName": "Guardian", "bungieGlobalDisplayNameCode": 42 }
+		] }`))
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	results, err := client.SearchProfiles(context.Background(), "Guardian#0042")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].MembershipId != "300" || results[0].BungieName != "Guardian#0042" {
+		t.Errorf("expected only the cross save membership, got %+v", results)
+	}
+}
+
+func TestResolvePrimaryMembership(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if r.URL.Query().Get("getAllMemberships") != "true" {
+			t.Errorf("expected overridden memberships to be requested")
+		}
+
+		w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "profiles": [
+			{ "membershipType": 1, "membershipId": "100", "isOverridden": true },
+			{ "membershipType": 3, "membershipId": "300", "isCrossSavePrimary": true }
+		] } }`))
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	for i := 0; i < 2; i++ {
+		membership := client.ResolvePrimaryMembership(context.Background(), MembershipPair{MembershipType: 1, MembershipId: "100"})
+		if membership != (MembershipPair{MembershipType: 3, MembershipId: "300"}) {
+			t.Errorf("expected the cross save primary membership, got %+v", membership)
+		}
+	}
+
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("expected the primary membership to be cached, got %v requests", requests)
+	}
+}
+
+func TestResolvePrimaryMembershipFallsBackOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "ErrorCode": 1601, "ErrorStatus": "DestinyAccountNotFound", "Message": "Not found" }`))
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	requestedMembership := MembershipPair{MembershipType: 3, MembershipId: "100"}
+	if membership := client.ResolvePrimaryMembership(context.Background(), requestedMembership); membership != requestedMembership {
+		t.Errorf("expected the requested membership, got %+v", membership)
+	}
+}
+
+func TestSearchProfilesListsEachPlatformWithoutCrossSave(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "searchResults": [
+			{ "bungieGlobalDisplayName": "Guardian", "bungieGlobalDisplayNameCode": 42, "destinyMemberships": [
+				{ "membershipType": 1, "membershipId": "100", "crossSaveOverride": 0 },
+				{ "membershipType": 3, "membershipId": "300", "crossSaveOverride": 0 }
+			] },
+			{ "bungieGlobalDisplayName": "Guardian", "bungieGlobalDisplayNameCode": 7, "destinyMemberships": [] }
+		] } }`))
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	results, err := client.SearchProfiles(context.Background(), "Guard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0].MembershipId != "100" || results[1].MembershipId != "300" || results[1].MembershipTypeName != "Steam" {
+		t.Errorf("expected a result for each of the player's platforms, got %+v", results)
+	}
+}
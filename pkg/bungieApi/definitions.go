@@ -1,86 +1,353 @@
 package bungieAPI
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
+	backend "github.com/grafana/grafana-plugin-sdk-go/backend"
 	bungie "github.com/joshhunt/bungieapigo/pkg/models"
 )
 
 var (
-	cachedActivityModeDef = DestinyActivityModeDefinitionMap{}
-	cachedActivityDefs    = DestinyActivityDefinitionMap{}
+	DEFAULT_LOCALE = "en"
+	// Every locale Bungie publishes manifest definitions in
+	LOCALES = []string{"en", "fr", "es", "es-mx", "de", "it", "ja", "pt-br", "ru", "pl", "ko", "zh-cht", "zh-chs"}
+	// How long a manifest is trusted before checking Bungie for a new version
+	MANIFEST_CHECK_INTERVAL = time.Minute * 5
 )
 
-func (bungieAPI BungieAPI) initializeCachedActivityModeDef() error {
-	body, err := bungieAPI.RequestDefinitionTable("DestinyActivityModeDefinition")
+func IsSupportedLocale(locale string) bool {
+	for _, supportedLocale := range LOCALES {
+		if supportedLocale == locale {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ForLocale returns a copy of the client that looks up definitions in the locale. The copy
+// shares the original's caches and rate limiter.
+func (bungieAPI BungieAPI) ForLocale(locale string) BungieAPI {
+	bungieAPI.locale = locale
+	return bungieAPI
+}
+
+type definitionTableKey struct {
+	version   string
+	locale    string
+	tableName string
+}
+
+type manifestLoad struct {
+	done     chan struct{}
+	manifest *bungie.DestinyManifest
+	err      error
+}
+
+type definitionTableLoad struct {
+	done  chan struct{}
+	table any
+	err   error
+}
+
+// definitionStore caches definition tables for the current manifest version. Concurrent requests
+// for the same manifest or table share a single download, and tables from previous manifest
+// versions are dropped once Bungie reports a new one. Until then, the most recent manifest in the
+// disk cache is used, so definitions are available offline and straight after a restart.
+type definitionStore struct {
+	mu                sync.Mutex
+	manifest          *bungie.DestinyManifest
+	manifestLoadedAt  time.Time
+	manifestLoad      *manifestLoad
+	tables            map[definitionTableKey]*definitionTableLoad
+	diskCacheReadOnce sync.Once
+}
+
+func newDefinitionStore() *definitionStore {
+	return &definitionStore{
+		tables: map[definitionTableKey]*definitionTableLoad{},
+	}
+}
+
+// loadCachedManifest serves the manifest a previous run saved to the disk cache, along with its
+// cached tables, until it's time to check Bungie for a newer version.
+func (store *definitionStore) loadCachedManifest(bungieAPI BungieAPI) {
+	if bungieAPI.diskCache == nil {
+		return
+	}
+
+	manifest, ok := bungieAPI.diskCache.readLatestManifest()
+	if !ok {
+		return
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.manifest == nil {
+		store.manifest = manifest
+		store.manifestLoadedAt = time.Now()
+	}
+}
+
+func (store *definitionStore) currentManifest(ctx context.Context, bungieAPI BungieAPI) (*bungie.DestinyManifest, error) {
+	store.diskCacheReadOnce.Do(func() { store.loadCachedManifest(bungieAPI) })
+
+	store.mu.Lock()
+	if store.manifest != nil && time.Since(store.manifestLoadedAt) < MANIFEST_CHECK_INTERVAL {
+		manifest := store.manifest
+		store.mu.Unlock()
+		return manifest, nil
+	}
+
+	load := store.manifestLoad
+	if load == nil {
+		load = &manifestLoad{done: make(chan struct{})}
+		store.manifestLoad = load
+
+		// Loads are shared between requests, so one cancelled panel must not fail the others
+		go store.loadManifest(context.WithoutCancel(ctx), bungieAPI, load)
+	}
+	store.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-load.done:
+		return load.manifest, load.err
+	}
+}
+
+func (store *definitionStore) loadManifest(ctx context.Context, bungieAPI BungieAPI, load *manifestLoad) {
+	defer close(load.done)
+
+	manifest, err := bungieAPI.RequestManifest(ctx)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.manifestLoad = nil
+
+	if err != nil {
+		if store.manifest == nil {
+			load.err = fmt.Errorf("unable to get manifest: %w", err)
+			return
+		}
+
+		// Keep serving the definitions we have until Bungie is reachable again
+		backend.Logger.Warn("Unable to check for a new manifest version", "error", err, "version", store.manifest.Version)
+		load.manifest = store.manifest
+		store.manifestLoadedAt = time.Now()
+		return
+	}
+
+	if store.manifest != nil && store.manifest.Version != manifest.Version {
+		backend.Logger.Info("New manifest version", "previousVersion", store.manifest.Version, "version", manifest.Version)
+	}
+
+	if bungieAPI.diskCache != nil && (store.manifest == nil || store.manifest.Version != manifest.Version) {
+		// Saved before anything else can use the new version, so a restart always finds the manifest
+		// for whichever tables were cached
+		err := bungieAPI.diskCache.writeManifest(manifest)
+		if err != nil {
+			backend.Logger.Warn("Unable to cache manifest", "error", err, "version", manifest.Version)
+		}
+
+		go bungieAPI.diskCache.removeOtherVersions(manifest.Version)
+	}
+
+	for key := range store.tables {
+		if key.version != manifest.Version {
+			delete(store.tables, key)
+		}
+	}
+
+	store.manifest = manifest
+	store.manifestLoadedAt = time.Now()
+	load.manifest = manifest
+}
+
+// loadDefinitionTable reads the table from the disk cache, falling back to downloading it from Bungie.
+func (bungieAPI BungieAPI) loadDefinitionTable(ctx context.Context, manifest *bungie.DestinyManifest, locale string, tableName string) ([]byte, error) {
+	if bungieAPI.diskCache != nil {
+		if body, ok := bungieAPI.diskCache.read(manifest.Version, locale, tableName); ok {
+			return body, nil
+		}
+	}
+
+	body, err := bungieAPI.requestDefinitionTableForManifest(ctx, manifest, locale, tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonErr := json.Unmarshal(body, &cachedActivityModeDef)
-	if jsonErr != nil {
-		return err
+	if bungieAPI.diskCache != nil {
+		err := bungieAPI.diskCache.write(manifest.Version, locale, tableName, body)
+		if err != nil {
+			backend.Logger.Warn("Unable to cache definition table", "error", err, "table", tableName)
+		}
 	}
 
-	return nil
+	return body, nil
 }
 
-func (bungieAPI BungieAPI) GetActivityModeDefinitionForModeType(modeType int) *bungie.DestinyActivityModeDefinition {
-	if len(cachedActivityModeDef) == 0 {
-		/*err := */ bungieAPI.initializeCachedActivityModeDef()
-		// if err != nil {
-		// 	logger.Warn("Unable to fetch DestinyActivityModeDefinitions")
-		// }
+// getDefinitionTable returns the definition table for the current manifest version and locale,
+// downloading it if it isn't already cached.
+func getDefinitionTable[T any](ctx context.Context, bungieAPI BungieAPI, locale string, tableName string) (T, error) {
+	var table T
+
+	if bungieAPI.definitions == nil {
+		return table, fmt.Errorf("definitions are not available")
 	}
 
-	for _, def := range cachedActivityModeDef {
+	store := bungieAPI.definitions
+
+	manifest, err := store.currentManifest(ctx, bungieAPI)
+	if err != nil {
+		return table, err
+	}
+
+	key := definitionTableKey{version: manifest.Version, locale: locale, tableName: tableName}
+
+	store.mu.Lock()
+	load, ok := store.tables[key]
+	if !ok {
+		load = &definitionTableLoad{done: make(chan struct{})}
+		store.tables[key] = load
+
+		go func(ctx context.Context) {
+			defer close(load.done)
+
+			var loadedTable T
+			body, err := bungieAPI.loadDefinitionTable(ctx, manifest, locale, tableName)
+			if err == nil {
+				err = json.Unmarshal(body, &loadedTable)
+			}
+
+			if err != nil {
+				load.err = fmt.Errorf("unable to load %v: %w", tableName, err)
+
+				// Forget the failed load so the next request tries again
+				store.mu.Lock()
+				if store.tables[key] == load {
+					delete(store.tables, key)
+				}
+				store.mu.Unlock()
+				return
+			}
+
+			load.table = loadedTable
+		}(context.WithoutCancel(ctx))
+	}
+	store.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return table, ctx.Err()
+	case <-load.done:
+	}
+
+	if load.err != nil {
+		return table, load.err
+	}
+
+	return load.table.(T), nil
+}
+
+func (bungieAPI BungieAPI) GetActivityModeDefinitionForModeType(ctx context.Context, modeType int) (*bungie.DestinyActivityModeDefinition, error) {
+	allDefs, err := bungieAPI.GetAllActivityModeDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, def := range allDefs {
 		if def.ModeType == bungie.DestinyActivityModeType(modeType) {
-			return def
+			return def, nil
 		}
 	}
 
-	// logger.Warn("Unable to find activity mode definition", "hash", modeType)
-	return nil
+	return nil, nil
 }
 
-func (bungieAPI BungieAPI) GetAllActivityModeDefinitions() DestinyActivityModeDefinitionMap {
-	if len(cachedActivityModeDef) == 0 {
-		/*err := */ bungieAPI.initializeCachedActivityModeDef()
-		// if err != nil {
-		//     logger.Warn("Unable to fetch DestinyActivityModeDefinitions")
-		// }
+// GetActivityModeDefinitionForFriendlyName finds the activity mode by the name used to key stats responses, such as "allPvE".
+func (bungieAPI BungieAPI) GetActivityModeDefinitionForFriendlyName(ctx context.Context, friendlyName string) (*bungie.DestinyActivityModeDefinition, error) {
+	allDefs, err := bungieAPI.GetAllActivityModeDefinitions(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return cachedActivityModeDef
+	for _, def := range allDefs {
+		if def.FriendlyName == friendlyName {
+			return def, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (bungieAPI BungieAPI) GetAllActivityModeDefinitions(ctx context.Context) (DestinyActivityModeDefinitionMap, error) {
+	return getDefinitionTable[DestinyActivityModeDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyActivityModeDefinition")
 }
 
-func (bungieAPI BungieAPI) initializeCachedActivityDefs() error {
-	body, err := bungieAPI.RequestDefinitionTable("DestinyActivityDefinition")
+func (bungieAPI BungieAPI) GetActivityDefinitionForHash(ctx context.Context, hash int) (*bungie.DestinyActivityDefinition, error) {
+	allDefs, err := getDefinitionTable[DestinyActivityDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyActivityDefinition")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	jsonErr := json.Unmarshal(body, &cachedActivityDefs)
-	if jsonErr != nil {
-		return err
+	return allDefs[hash], nil
+}
+
+func (bungieAPI BungieAPI) GetHistoricalStatsDefinitions(ctx context.Context) (DestinyHistoricalStatsDefinitionMap, error) {
+	return getDefinitionTable[DestinyHistoricalStatsDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyHistoricalStatsDefinition")
+}
+
+func (bungieAPI BungieAPI) GetInventoryItemDefinitionForHash(ctx context.Context, hash int) (*InventoryItemDefinition, error) {
+	allDefs, err := getDefinitionTable[InventoryItemDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyInventoryItemDefinition")
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return allDefs[hash], nil
+}
+
+func (bungieAPI BungieAPI) GetRecordDefinitions(ctx context.Context) (RecordDefinitionMap, error) {
+	return getDefinitionTable[RecordDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyRecordDefinition")
+}
+
+func (bungieAPI BungieAPI) GetPresentationNodeDefinitions(ctx context.Context) (PresentationNodeDefinitionMap, error) {
+	return getDefinitionTable[PresentationNodeDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyPresentationNodeDefinition")
+}
+
+func (bungieAPI BungieAPI) GetCollectibleDefinitions(ctx context.Context) (CollectibleDefinitionMap, error) {
+	return getDefinitionTable[CollectibleDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyCollectibleDefinition")
+}
+
+func (bungieAPI BungieAPI) GetMetricDefinitions(ctx context.Context) (DestinyMetricDefinitionMap, error) {
+	return getDefinitionTable[DestinyMetricDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyMetricDefinition")
 }
 
-func (bungieAPI BungieAPI) GetActivityDefinitionForHash(hash int) *bungie.DestinyActivityDefinition {
-	if len(cachedActivityDefs) == 0 {
-		/*err := */ bungieAPI.initializeCachedActivityDefs()
-		// if err != nil {
-		//     logger.Warn("Unable to fetch DestinyActivityDefinitions")
-		// }
+func (bungieAPI BungieAPI) GetTraitDefinitions(ctx context.Context) (DestinyTraitDefinitionMap, error) {
+	return getDefinitionTable[DestinyTraitDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinyTraitDefinition")
+}
+
+func (bungieAPI BungieAPI) GetSeasonDefinitionForHash(ctx context.Context, hash int) (*bungie.DestinySeasonDefinition, error) {
+	allDefs, err := getDefinitionTable[DestinySeasonDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinySeasonDefinition")
+	if err != nil {
+		return nil, err
 	}
 
-	def := cachedActivityDefs[hash]
+	return allDefs[hash], nil
+}
 
-	// if def.Hash == 0 {
-	// 	logger.Warn("Unable to find activity definition", "hash", hash)
-	// }
+func (bungieAPI BungieAPI) GetSeasonPassDefinitionForHash(ctx context.Context, hash int) (*bungie.DestinySeasonPassDefinition, error) {
+	allDefs, err := getDefinitionTable[DestinySeasonPassDefinitionMap](ctx, bungieAPI, bungieAPI.locale, "DestinySeasonPassDefinition")
+	if err != nil {
+		return nil, err
+	}
 
-	return def
+	return allDefs[hash], nil
 }
@@ -0,0 +1,218 @@
+package bungieAPI
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetActivityDefinitionForHashSharesLoads(t *testing.T) {
+	var manifestVersion atomic.Value
+	manifestVersion.Store("1")
+	var tableRequests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Platform/Destiny2/Manifest/":
+			version := manifestVersion.Load().(string)
+			fmt.Fprintf(w, `{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": %q, "jsonWorldComponentContentPaths": { "en": { "DestinyActivityDefinition": "/activities-%v.json" } } } }`, version, version)
+		case "/activities-1.json", "/activities-2.json":
+			atomic.AddInt32(&tableRequests, 1)
+			fmt.Fprintf(w, `{ "123": { "hash": 123, "displayProperties": { "name": "Activity from %v" } } }`, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			def, err := client.GetActivityDefinitionForHash(context.Background(), 123)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if def == nil || def.DisplayProperties.Name != "Activity from /activities-1.json" {
+				t.Errorf("unexpected definition %+v", def)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if requests := atomic.LoadInt32(&tableRequests); requests != 1 {
+		t.Errorf("expected concurrent lookups to share one table download, got %v", requests)
+	}
+
+	// Force the next lookup to check the manifest version again
+	manifestVersion.Store("2")
+	client.definitions.mu.Lock()
+	client.definitions.manifestLoadedAt = client.definitions.manifestLoadedAt.Add(-MANIFEST_CHECK_INTERVAL)
+	client.definitions.mu.Unlock()
+
+	def, err := client.GetActivityDefinitionForHash(context.Background(), 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.DisplayProperties.Name != "Activity from /activities-2.json" {
+		t.Errorf("expected definitions to be reloaded for the new manifest version, got %q", def.DisplayProperties.Name)
+	}
+}
+
+func TestDefinitionTablesAreReadFromCacheDir(t *testing.T) {
+	var tableRequests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Platform/Destiny2/Manifest/":
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": "1", "jsonWorldComponentContentPaths": { "en": { "DestinyActivityDefinition": "/activities.json" } } } }`))
+		case "/activities.json":
+			atomic.AddInt32(&tableRequests, 1)
+			w.Write([]byte(`{ "123": { "hash": 123, "displayProperties": { "name": "Cached activity" } } }`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+
+	// Each client stands in for a fresh plugin process sharing the same cache directory
+	for i := 0; i < 2; i++ {
+		client := Create("test-key", WithBaseURL(server.URL), WithCacheDir(cacheDir))
+
+		def, err := client.GetActivityDefinitionForHash(context.Background(), 123)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if def == nil || def.DisplayProperties.Name != "Cached activity" {
+			t.Errorf("unexpected definition %+v", def)
+		}
+	}
+
+	if requests := atomic.LoadInt32(&tableRequests); requests != 1 {
+		t.Errorf("expected the definition table to be downloaded once, got %v", requests)
+	}
+}
+
+func TestRemoveOtherVersionsOnlyRemovesCacheVersions(t *testing.T) {
+	dir := t.TempDir()
+	cache := newDefinitionDiskCache(dir)
+
+	for _, version := range []string{"1", "2"} {
+		err := cache.write(version, "en", "DestinyActivityDefinition", []byte("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Unrelated data alongside the cache, and inside the cache's own directory
+	unrelatedDirs := []string{filepath.Join(dir, "plugins"), filepath.Join(cache.dir, "not-a-version")}
+	for _, unrelatedDir := range unrelatedDirs {
+		err := os.MkdirAll(unrelatedDir, 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache.removeOtherVersions("2")
+
+	if _, ok := cache.read("1", "en", "DestinyActivityDefinition"); ok {
+		t.Error("expected the previous version to be removed")
+	}
+
+	if _, ok := cache.read("2", "en", "DestinyActivityDefinition"); !ok {
+		t.Error("expected the current version to be kept")
+	}
+
+	for _, unrelatedDir := range unrelatedDirs {
+		if _, err := os.Stat(unrelatedDir); err != nil {
+			t.Errorf("expected %v to be left alone, got %v", unrelatedDir, err)
+		}
+	}
+}
+
+func TestDefinitionTablesUseDefinitionTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Platform/Destiny2/Manifest/":
+			fmt.Fprint(w, `{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": "1", "jsonWorldComponentContentPaths": { "en": { "DestinyActivityDefinition": "/activities.json" } } } }`)
+		case "/activities.json":
+			// Slower than the API timeout, as large tables are
+			time.Sleep(time.Millisecond * 200)
+			fmt.Fprint(w, `{ "123": { "hash": 123, "displayProperties": { "name": "Activity" } } }`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := Create("test-key", WithBaseURL(server.URL), WithTimeout(time.Millisecond*100), WithDefinitionTimeout(time.Second*5))
+
+	def, err := client.GetActivityDefinitionForHash(context.Background(), 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def == nil || def.DisplayProperties.Name != "Activity" {
+		t.Errorf("unexpected definition %+v", def)
+	}
+}
+
+func TestDefinitionsAreServedFromCacheWhenManifestFails(t *testing.T) {
+	var manifestAvailable atomic.Bool
+	manifestAvailable.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !manifestAvailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{ "ErrorCode": 5, "ErrorStatus": "SystemDisabled", "Message": "Maintenance" }`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/Platform/Destiny2/Manifest/":
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": "1", "jsonWorldComponentContentPaths": { "en": { "DestinyActivityDefinition": "/activities.json" } } } }`))
+		case "/activities.json":
+			w.Write([]byte(`{ "123": { "hash": 123, "displayProperties": { "name": "Cached activity" } } }`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cacheDir := t.TempDir()
+
+	_, err := Create("test-key", WithBaseURL(server.URL), WithCacheDir(cacheDir)).GetActivityDefinitionForHash(context.Background(), 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart while Bungie is down still has the definitions cached by the previous run
+	manifestAvailable.Store(false)
+	client := Create("test-key", WithBaseURL(server.URL), WithCacheDir(cacheDir))
+
+	def, err := client.GetActivityDefinitionForHash(context.Background(), 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def == nil || def.DisplayProperties.Name != "Cached activity" {
+		t.Errorf("expected the cached definition, got %+v", def)
+	}
+}
@@ -0,0 +1,200 @@
+package bungieAPI
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	backend "github.com/grafana/grafana-plugin-sdk-go/backend"
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+var (
+	// The cache lives in its own subdirectory of the configured cache directory, which may be shared
+	DEFINITION_CACHE_SUBDIR = "destiny-definitions"
+	// Marks a manifest version directory as created by the cache, so it's safe to delete
+	VERSION_MARKER_FILE = ".definition-cache-version"
+	// The manifest a version's tables came from, so they can be used without asking Bungie for it again
+	MANIFEST_FILE = "manifest.json"
+)
+
+// definitionDiskCache persists downloaded definition tables between plugin restarts, laid out
+// as <dir>/<manifest version>/<locale>/<table name>.json, alongside the manifest itself at
+// <dir>/<manifest version>/manifest.json
+type definitionDiskCache struct {
+	dir string
+}
+
+func newDefinitionDiskCache(dir string) *definitionDiskCache {
+	return &definitionDiskCache{dir: filepath.Join(dir, DEFINITION_CACHE_SUBDIR)}
+}
+
+func sanitizePathSegment(segment string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, segment)
+}
+
+func (cache definitionDiskCache) versionDir(version string) string {
+	return filepath.Join(cache.dir, sanitizePathSegment(version))
+}
+
+func (cache definitionDiskCache) tablePath(version string, locale string, tableName string) string {
+	return filepath.Join(cache.versionDir(version), sanitizePathSegment(locale), sanitizePathSegment(tableName)+".json")
+}
+
+func (cache definitionDiskCache) read(version string, locale string, tableName string) ([]byte, bool) {
+	body, err := os.ReadFile(cache.tablePath(version, locale, tableName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			backend.Logger.Warn("Unable to read cached definition table", "error", err, "table", tableName)
+		}
+		return nil, false
+	}
+
+	return body, true
+}
+
+// write saves the table to the version's directory.
+func (cache definitionDiskCache) write(version string, locale string, tableName string, body []byte) error {
+	tablePath := cache.tablePath(version, locale, tableName)
+
+	err := cache.markVersion(version)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(tablePath, body)
+}
+
+// writeManifest saves the manifest with its version's tables, so it can be loaded by readLatestManifest.
+func (cache definitionDiskCache) writeManifest(manifest *bungie.DestinyManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	err = cache.markVersion(manifest.Version)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(filepath.Join(cache.versionDir(manifest.Version), MANIFEST_FILE), body)
+}
+
+// readLatestManifest returns the most recently saved manifest, for serving cached tables before
+// (or without) Bungie reporting the current version.
+func (cache definitionDiskCache) readLatestManifest() (*bungie.DestinyManifest, bool) {
+	entries, err := os.ReadDir(cache.dir)
+	if err != nil {
+		return nil, false
+	}
+
+	var latestPath string
+	var latestModTime time.Time
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		_, err := os.Stat(filepath.Join(cache.dir, entry.Name(), VERSION_MARKER_FILE))
+		if err != nil {
+			continue
+		}
+
+		manifestPath := filepath.Join(cache.dir, entry.Name(), MANIFEST_FILE)
+		info, err := os.Stat(manifestPath)
+		if err != nil || info.ModTime().Before(latestModTime) {
+			continue
+		}
+
+		latestPath = manifestPath
+		latestModTime = info.ModTime()
+	}
+
+	if latestPath == "" {
+		return nil, false
+	}
+
+	body, err := os.ReadFile(latestPath)
+	if err != nil {
+		backend.Logger.Warn("Unable to read cached manifest", "error", err)
+		return nil, false
+	}
+
+	manifest := &bungie.DestinyManifest{}
+	err = json.Unmarshal(body, manifest)
+	if err != nil || manifest.Version == "" {
+		backend.Logger.Warn("Unable to read cached manifest", "error", err)
+		return nil, false
+	}
+
+	return manifest, true
+}
+
+// markVersion creates the version's directory along with the marker that it belongs to the cache.
+func (cache definitionDiskCache) markVersion(version string) error {
+	err := os.MkdirAll(cache.versionDir(version), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(cache.versionDir(version), VERSION_MARKER_FILE), []byte(version), 0o644)
+}
+
+// writeFileAtomically writes via a temporary file so a crash mid-write never leaves a truncated file behind.
+func writeFileAtomically(path string, body []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(body)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), path)
+}
+
+// removeOtherVersions deletes cached tables from every manifest version except the current one.
+// Directories without the cache's marker file weren't created by it, and are left alone.
+func (cache definitionDiskCache) removeOtherVersions(version string) {
+	entries, err := os.ReadDir(cache.dir)
+	if err != nil {
+		return
+	}
+
+	currentVersionDir := sanitizePathSegment(version)
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == currentVersionDir {
+			continue
+		}
+
+		_, err := os.Stat(filepath.Join(cache.dir, entry.Name(), VERSION_MARKER_FILE))
+		if err != nil {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(cache.dir, entry.Name()))
+		if err != nil {
+			backend.Logger.Warn("Unable to remove outdated definition cache", "error", err, "version", entry.Name())
+		}
+	}
+}
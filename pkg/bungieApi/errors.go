@@ -0,0 +1,107 @@
+package bungieAPI
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+// Kinds of Bungie API failure. A *BungieError wraps exactly one of these, so callers
+// can check the kind with errors.Is.
+var (
+	ErrPrivacyRestricted = errors.New("privacy restricted")
+	ErrNotFound          = errors.New("not found")
+	ErrThrottled         = errors.New("throttled")
+	ErrSystemDisabled    = errors.New("system disabled")
+	ErrInvalidAPIKey     = errors.New("invalid API key")
+	ErrUpstream          = errors.New("upstream error")
+	ErrRequestFailed     = errors.New("request failed")
+)
+
+// BungieError is an error response from the Bungie API, either from the platform response
+// envelope or an unsuccessful HTTP status.
+type BungieError struct {
+	Kind        error
+	StatusCode  int
+	ErrorCode   int
+	ErrorStatus string
+	Message     string
+}
+
+func (bungieError *BungieError) Error() string {
+	if bungieError.ErrorStatus != "" {
+		return fmt.Sprintf("%v: %v", bungieError.ErrorStatus, bungieError.Message)
+	}
+
+	return fmt.Sprintf("Bungie API responded with HTTP %v", bungieError.StatusCode)
+}
+
+func (bungieError *BungieError) Unwrap() error {
+	return bungieError.Kind
+}
+
+func errorKindForErrorCode(errorCode int) error {
+	switch errorCode {
+	case bungie.PlatformErrorCodesDestinyPrivacyRestriction,
+		bungie.PlatformErrorCodesPsnApiProfilePrivacyRestriction:
+		return ErrPrivacyRestricted
+	case bungie.PlatformErrorCodesDestinyAccountNotFound,
+		bungie.PlatformErrorCodesDestinyCharacterNotFound,
+		bungie.PlatformErrorCodesUserCannotResolveCentralAccount,
+		bungie.PlatformErrorCodesGroupNotFound,
+		bungie.PlatformErrorCodesClanNotFound:
+		return ErrNotFound
+	case bungie.PlatformErrorCodesSystemDisabled:
+		return ErrSystemDisabled
+	case bungie.PlatformErrorCodesApiInvalidOrExpiredKey,
+		bungie.PlatformErrorCodesApiKeyMissingFromRequest:
+		return ErrInvalidAPIKey
+	}
+
+	if isRetryableErrorCode(errorCode) {
+		return ErrThrottled
+	}
+
+	return ErrRequestFailed
+}
+
+func errorKindForStatusCode(statusCode int) error {
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrInvalidAPIKey
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusTooManyRequests:
+		return ErrThrottled
+	case statusCode == http.StatusServiceUnavailable:
+		return ErrSystemDisabled
+	case statusCode >= http.StatusInternalServerError:
+		return ErrUpstream
+	default:
+		return ErrRequestFailed
+	}
+}
+
+// responseError returns a *BungieError if the response was unsuccessful, or nil otherwise.
+func responseError[T any](statusCode int, envelope DestinyResponse[T]) error {
+	if envelope.ErrorCode != bungie.PlatformErrorCodesNone && envelope.ErrorCode != bungie.PlatformErrorCodesSuccess {
+		return &BungieError{
+			Kind:        errorKindForErrorCode(envelope.ErrorCode),
+			StatusCode:  statusCode,
+			ErrorCode:   envelope.ErrorCode,
+			ErrorStatus: envelope.ErrorStatus,
+			Message:     envelope.Message,
+		}
+	}
+
+	if statusCode >= http.StatusBadRequest {
+		return &BungieError{
+			Kind:       errorKindForStatusCode(statusCode),
+			StatusCode: statusCode,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package bungieAPI
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+// The most pages of clan members to request. Clans are capped at 100 members, but Bungie doesn't
+// document the page size, so this leaves room for it to be smaller than a full clan.
+var MAX_GROUP_MEMBER_PAGES = 5
+
+func (bungieAPI BungieAPI) RequestGroup(ctx context.Context, groupID string) (*bungie.GroupResponse, error) {
+	path := fmt.Sprintf("/Platform/GroupV2/%v/", groupID)
+	body, err := bungieAPI.Get(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.GroupResponse]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return &resp.Response, nil
+}
+
+func (bungieAPI BungieAPI) RequestClanByName(ctx context.Context, clanName string) (*bungie.GroupResponse, error) {
+	requestBody := bungie.GroupNameSearchRequest{GroupName: clanName, GroupType: bungie.GroupTypeClan}
+	body, err := bungieAPI.Post(ctx, "/Platform/GroupV2/NameV2/", requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.GroupResponse]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return &resp.Response, nil
+}
+
+// RequestGroupMembers returns every member of the group, requesting further pages while Bungie
+// reports there are more.
+func (bungieAPI BungieAPI) RequestGroupMembers(ctx context.Context, groupID string) ([]bungie.GroupMember, error) {
+	path := fmt.Sprintf("/Platform/GroupV2/%v/Members/", groupID)
+	members := []bungie.GroupMember{}
+
+	for page := 1; page <= MAX_GROUP_MEMBER_PAGES; page++ {
+		query := url.Values{}
+		query.Set("currentpage", strconv.Itoa(page))
+
+		body, err := bungieAPI.Get(ctx, path, query)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := DestinyResponse[bungie.SearchResultOfGroupMember]{}
+		jsonErr := json.Unmarshal(body, &resp)
+		if jsonErr != nil {
+			return nil, jsonErr
+		}
+
+		members = append(members, resp.Response.Results...)
+
+		if !resp.Response.HasMore || len(resp.Response.Results) == 0 {
+			break
+		}
+	}
+
+	return members, nil
+}
+
+// SearchClans finds clans by their exact name, or by group ID when the query is numeric.
+func (bungieAPI BungieAPI) SearchClans(ctx context.Context, query string) ([]ClanSearchResourceResponseItem, error) {
+	results := []ClanSearchResourceResponseItem{}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return results, nil
+	}
+
+	var group *bungie.GroupResponse
+	var err error
+
+	if _, parseErr := strconv.ParseInt(query, 10, 64); parseErr == nil {
+		group, err = bungieAPI.RequestGroup(ctx, query)
+	} else {
+		group, err = bungieAPI.RequestClanByName(ctx, query)
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results = append(results, ClanSearchResourceResponseItem{
+		GroupId:     strconv.FormatInt(group.Detail.GroupId, 10),
+		Name:        group.Detail.Name,
+		Callsign:    group.Detail.ClanInfo.ClanCallsign,
+		MemberCount: group.Detail.MemberCount,
+	})
+
+	return results, nil
+}
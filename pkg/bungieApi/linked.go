@@ -0,0 +1,152 @@
+package bungieAPI
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	backend "github.com/grafana/grafana-plugin-sdk-go/backend"
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+func (bungieAPI BungieAPI) RequestLinkedProfiles(ctx context.Context, membershipType int, membershipID string) (*bungie.DestinyLinkedProfilesResponse, error) {
+	path := fmt.Sprintf("/Platform/Destiny2/%v/Profile/%v/LinkedProfiles/", membershipType, membershipID)
+
+	// Include memberships overridden by cross save, so they can be resolved to the primary membership
+	query := url.Values{}
+	query.Set("getAllMemberships", "true")
+
+	body, err := bungieAPI.Get(ctx, path, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.DestinyLinkedProfilesResponse]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return &resp.Response, nil
+}
+
+func linkedMembershipItem(profile bungie.DestinyProfileUserInfoCard) LinkedMembershipResourceResponseItem {
+	return LinkedMembershipResourceResponseItem{
+		MembershipPair: MembershipPair{
+			MembershipType: int(profile.MembershipType),
+			MembershipId:   strconv.FormatInt(profile.MembershipId, 10),
+		},
+		DisplayName:        profile.DisplayName,
+		IsCrossSavePrimary: profile.IsCrossSavePrimary,
+		IsOverridden:       profile.IsOverridden,
+		DateLastPlayed:     profile.DateLastPlayed,
+	}
+}
+
+// RequestLinkedMemberships lists every platform membership linked to the given membership's account.
+func (bungieAPI BungieAPI) RequestLinkedMemberships(ctx context.Context, membership MembershipPair) ([]LinkedMembershipResourceResponseItem, error) {
+	linkedProfiles, err := bungieAPI.RequestLinkedProfiles(ctx, membership.MembershipType, membership.MembershipId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := make([]LinkedMembershipResourceResponseItem, 0, len(linkedProfiles.Profiles))
+	for _, profile := range linkedProfiles.Profiles {
+		memberships = append(memberships, linkedMembershipItem(profile))
+	}
+
+	return memberships, nil
+}
+
+// primaryMembershipCache remembers which membership cross save directs each membership's Destiny
+// data to, as nearly every profile query needs it and it rarely changes.
+type primaryMembershipCache struct {
+	mu      sync.Mutex
+	entries map[MembershipPair]primaryMembershipCacheEntry
+}
+
+type primaryMembershipCacheEntry struct {
+	primaryMembership MembershipPair
+	expiresAt         time.Time
+}
+
+func newPrimaryMembershipCache() *primaryMembershipCache {
+	return &primaryMembershipCache{
+		entries: map[MembershipPair]primaryMembershipCacheEntry{},
+	}
+}
+
+func (cache *primaryMembershipCache) get(membership MembershipPair) (MembershipPair, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[membership]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return membership, false
+	}
+
+	return entry.primaryMembership, true
+}
+
+func (cache *primaryMembershipCache) set(membership MembershipPair, primaryMembership MembershipPair) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.entries[membership] = primaryMembershipCacheEntry{
+		primaryMembership: primaryMembership,
+		expiresAt:         time.Now().Add(PRIMARY_MEMBERSHIP_CACHE_TTL),
+	}
+}
+
+// ResolvePrimaryMembership returns the membership cross save directs the account's Destiny data to.
+// Memberships of accounts without cross save are returned unchanged, as is the membership when its
+// linked memberships can't be requested, so queries against it can still run.
+func (bungieAPI BungieAPI) ResolvePrimaryMembership(ctx context.Context, membership MembershipPair) MembershipPair {
+	if bungieAPI.primaryMemberships != nil {
+		if primaryMembership, ok := bungieAPI.primaryMemberships.get(membership); ok {
+			return primaryMembership
+		}
+	}
+
+	memberships, err := bungieAPI.RequestLinkedMemberships(ctx, membership)
+	if err != nil {
+		backend.Logger.Warn("Unable to resolve primary membership", "error", err, "membershipType", membership.MembershipType, "membershipId", membership.MembershipId)
+		return membership
+	}
+
+	primaryMembership := membership
+	for _, linkedMembership := range memberships {
+		if linkedMembership.IsCrossSavePrimary {
+			primaryMembership = linkedMembership.MembershipPair
+			break
+		}
+	}
+
+	if bungieAPI.primaryMemberships != nil {
+		bungieAPI.primaryMemberships.set(membership, primaryMembership)
+	}
+
+	return primaryMembership
+}
+
+// RequestActiveLinkedMemberships returns the account's memberships that have Destiny data of their
+// own, leaving out those overridden by cross save.
+func (bungieAPI BungieAPI) RequestActiveLinkedMemberships(ctx context.Context, membership MembershipPair) ([]MembershipPair, error) {
+	memberships, err := bungieAPI.RequestLinkedMemberships(ctx, membership)
+	if err != nil {
+		return nil, err
+	}
+
+	activeMemberships := []MembershipPair{}
+	for _, linkedMembership := range memberships {
+		if !linkedMembership.IsOverridden {
+			activeMemberships = append(activeMemberships, linkedMembership.MembershipPair)
+		}
+	}
+
+	return activeMemberships, nil
+}
@@ -0,0 +1,138 @@
+package bungieAPI
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+var (
+	REQUESTS_PER_SECOND = 20.0
+	REQUESTS_BURST      = 20.0
+	MAX_RETRIES         = 3
+	RETRY_BASE_DELAY    = time.Millisecond * 500
+
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rateLimiter{}
+)
+
+// rateLimiter is a token bucket shared by every client using the same API key, so that
+// many panels refreshing at once don't exceed Bungie's per-application throttle.
+type rateLimiter struct {
+	mu          sync.Mutex
+	tokens      float64
+	capacity    float64
+	rate        float64
+	lastRefill  time.Time
+	pausedUntil time.Time
+}
+
+func newRateLimiter(rate float64, burst float64) *rateLimiter {
+	return &rateLimiter{
+		tokens:     burst,
+		capacity:   burst,
+		rate:       rate,
+		lastRefill: time.Now(),
+	}
+}
+
+func rateLimiterForKey(apiKey string) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	limiter, ok := rateLimiters[apiKey]
+	if !ok {
+		limiter = newRateLimiter(REQUESTS_PER_SECOND, REQUESTS_BURST)
+		rateLimiters[apiKey] = limiter
+	}
+
+	return limiter
+}
+
+// Wait blocks until a request may be made, or the context is done.
+func (limiter *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		limiter.mu.Lock()
+		now := time.Now()
+
+		limiter.tokens = math.Min(limiter.capacity, limiter.tokens+now.Sub(limiter.lastRefill).Seconds()*limiter.rate)
+		limiter.lastRefill = now
+
+		var wait time.Duration
+		if now.Before(limiter.pausedUntil) {
+			wait = limiter.pausedUntil.Sub(now)
+		} else if limiter.tokens >= 1 {
+			limiter.tokens -= 1
+			limiter.mu.Unlock()
+			return nil
+		} else {
+			wait = time.Duration((1 - limiter.tokens) / limiter.rate * float64(time.Second))
+		}
+		limiter.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// PauseFor stops all requests sharing this limiter for the duration, such as when Bungie
+// responds with ThrottleSeconds.
+func (limiter *rateLimiter) PauseFor(duration time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	until := time.Now().Add(duration)
+	if until.After(limiter.pausedUntil) {
+		limiter.pausedUntil = until
+	}
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isRetryableStatusCode(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+func isRetryableErrorCode(errorCode int) bool {
+	switch errorCode {
+	case bungie.PlatformErrorCodesSystemDisabled,
+		bungie.PlatformErrorCodesThrottleLimitExceeded,
+		bungie.PlatformErrorCodesThrottleLimitExceededMinutes,
+		bungie.PlatformErrorCodesThrottleLimitExceededMomentarily,
+		bungie.PlatformErrorCodesThrottleLimitExceededSeconds,
+		bungie.PlatformErrorCodesPerEndpointRequestThrottleExceeded,
+		bungie.PlatformErrorCodesPerApplicationThrottleExceeded,
+		bungie.PlatformErrorCodesPerApplicationAnonymousThrottleExceeded,
+		bungie.PlatformErrorCodesDestinyThrottledByGameServer:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryDelay is the exponential backoff for the attempt, or ThrottleSeconds if Bungie asked for longer.
+func retryDelay(attempt int, throttleSeconds int) time.Duration {
+	delay := RETRY_BASE_DELAY * time.Duration(1<<attempt)
+	throttle := time.Second * time.Duration(throttleSeconds)
+
+	if throttle > delay {
+		return throttle
+	}
+
+	return delay
+}
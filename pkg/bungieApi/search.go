@@ -0,0 +1,138 @@
+package bungieAPI
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+// FormatBungieName returns the player's full Bungie Name, or their platform display name for
+// accounts that don't have one.
+func FormatBungieName(userInfo bungie.UserInfoCard) string {
+	if userInfo.BungieGlobalDisplayName == "" {
+		return userInfo.DisplayName
+	}
+
+	return fmt.Sprintf("%v#%04d", userInfo.BungieGlobalDisplayName, userInfo.BungieGlobalDisplayNameCode)
+}
+
+// parseBungieName splits a full Bungie Name like "Name#1234" into its name and code.
+func parseBungieName(bungieName string) (string, int, bool) {
+	separatorIndex := strings.LastIndex(bungieName, "#")
+	if separatorIndex < 1 {
+		return "", 0, false
+	}
+
+	code, err := strconv.Atoi(bungieName[separatorIndex+1:])
+	if err != nil {
+		return "", 0, false
+	}
+
+	return bungieName[:separatorIndex], code, true
+}
+
+func (bungieAPI BungieAPI) SearchDestinyPlayerByBungieName(ctx context.Context, displayName string, displayNameCode int) ([]bungie.UserInfoCard, error) {
+	path := fmt.Sprintf("/Platform/Destiny2/SearchDestinyPlayerByBungieName/%v/", bungie.BungieMembershipTypeAll)
+	requestBody := exactSearchRequest{DisplayName: displayName, DisplayNameCode: displayNameCode}
+
+	body, err := bungieAPI.Post(ctx, path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[[]bungie.UserInfoCard]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return resp.Response, nil
+}
+
+func (bungieAPI BungieAPI) SearchUsersByGlobalName(ctx context.Context, displayNamePrefix string, page int) (*bungie.UserSearchResponse, error) {
+	path := fmt.Sprintf("/Platform/User/Search/GlobalName/%v/", page)
+	requestBody := userSearchPrefixRequest{DisplayNamePrefix: displayNamePrefix}
+
+	body, err := bungieAPI.Post(ctx, path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := DestinyResponse[bungie.UserSearchResponse]{}
+	jsonErr := json.Unmarshal(body, &resp)
+	if jsonErr != nil {
+		return nil, jsonErr
+	}
+
+	return &resp.Response, nil
+}
+
+// searchMemberships returns the memberships to list for a player: each of their platforms has
+// its own Destiny profile, except for memberships cross save overrides to another of the
+// player's memberships, whose Destiny data is the primary membership's.
+func searchMemberships(memberships []bungie.UserInfoCard) []bungie.UserInfoCard {
+	membershipTypes := map[bungie.BungieMembershipType]bool{}
+	for _, membership := range memberships {
+		membershipTypes[membership.MembershipType] = true
+	}
+
+	results := []bungie.UserInfoCard{}
+	for _, membership := range memberships {
+		override := membership.CrossSaveOverride
+		if override != 0 && override != membership.MembershipType && membershipTypes[override] {
+			continue
+		}
+
+		results = append(results, membership)
+	}
+
+	return results
+}
+
+func (bungieAPI BungieAPI) profileSearchResult(bungieName string, membership bungie.UserInfoCard) ProfileSearchResourceResponseItem {
+	return ProfileSearchResourceResponseItem{
+		BungieName:         bungieName,
+		DisplayName:        membership.DisplayName,
+		MembershipId:       strconv.FormatInt(membership.MembershipId, 10),
+		MembershipType:     int(membership.MembershipType),
+		MembershipTypeName: bungieAPI.GetMembershipTypeName(int(membership.MembershipType)),
+	}
+}
+
+// SearchProfiles finds players by Bungie Name. A full name like "Name#1234" is looked up exactly,
+// anything else is searched as a name prefix.
+func (bungieAPI BungieAPI) SearchProfiles(ctx context.Context, query string) ([]ProfileSearchResourceResponseItem, error) {
+	results := []ProfileSearchResourceResponseItem{}
+
+	if displayName, displayNameCode, ok := parseBungieName(query); ok {
+		memberships, err := bungieAPI.SearchDestinyPlayerByBungieName(ctx, displayName, displayNameCode)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, membership := range searchMemberships(memberships) {
+			results = append(results, bungieAPI.profileSearchResult(FormatBungieName(membership), membership))
+		}
+
+		return results, nil
+	}
+
+	searchResponse, err := bungieAPI.SearchUsersByGlobalName(ctx, query, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range searchResponse.SearchResults {
+		// Bungie.net accounts that have never played Destiny have no memberships, so aren't listed
+		bungieName := fmt.Sprintf("%v#%04d", user.BungieGlobalDisplayName, user.BungieGlobalDisplayNameCode)
+		for _, membership := range searchMemberships(user.DestinyMemberships) {
+			results = append(results, bungieAPI.profileSearchResult(bungieName, membership))
+		}
+	}
+
+	return results, nil
+}
@@ -1,6 +1,10 @@
 package bungieAPI
 
-import bungie "github.com/joshhunt/bungieapigo/pkg/models"
+import (
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
 
 type MembershipPair struct {
 	MembershipType int    `json:"membershipType"`
@@ -8,10 +12,11 @@ type MembershipPair struct {
 }
 
 type DestinyResponse[T any] struct {
-	Response    T      `json:"Response"`
-	ErrorCode   int    `json:"ErrorCode"`
-	ErrorStatus string `json:"ErrorStatus"`
-	Message     string `json:"Message"`
+	Response        T      `json:"Response"`
+	ErrorCode       int    `json:"ErrorCode"`
+	ThrottleSeconds int    `json:"ThrottleSeconds"`
+	ErrorStatus     string `json:"ErrorStatus"`
+	Message         string `json:"Message"`
 }
 
 type ListCharactersResourceResponseItem struct {
@@ -19,10 +24,153 @@ type ListCharactersResourceResponseItem struct {
 	Description string `json:"description"`
 }
 
+// ProfileSearchResourceResponseItem is a player found by profile search, identified by their
+// primary (cross save) membership.
+type ProfileSearchResourceResponseItem struct {
+	BungieName         string `json:"bungieName"`
+	DisplayName        string `json:"displayName"`
+	MembershipId       string `json:"membershipId"`
+	MembershipType     int    `json:"membershipType"`
+	MembershipTypeName string `json:"membershipTypeName"`
+}
+
+// LinkedMembershipResourceResponseItem is one of the platform memberships linked to a player's
+// Bungie.net account.
+type LinkedMembershipResourceResponseItem struct {
+	MembershipPair
+	MembershipTypeName string    `json:"membershipTypeName"`
+	DisplayName        string    `json:"displayName"`
+	IsCrossSavePrimary bool      `json:"isCrossSavePrimary"`
+	IsOverridden       bool      `json:"isOverridden"`
+	DateLastPlayed     time.Time `json:"dateLastPlayed"`
+}
+
+type ClanSearchResourceResponseItem struct {
+	GroupId     string `json:"groupId"`
+	Name        string `json:"name"`
+	Callsign    string `json:"callsign"`
+	MemberCount int    `json:"memberCount"`
+}
+
 type ListActivityModeResourceResponseItem struct {
 	Value int    `json:"value"`
 	Label string `json:"label"`
 }
 
+type ListMetricResourceResponseItem struct {
+	Value       int      `json:"value"`
+	Label       string   `json:"label"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Traits      []string `json:"traits"`
+}
+
 type DestinyActivityDefinitionMap map[int]*bungie.DestinyActivityDefinition
 type DestinyActivityModeDefinitionMap map[int]*bungie.DestinyActivityModeDefinition
+type DestinyHistoricalStatsDefinitionMap map[string]*bungie.DestinyHistoricalStatsDefinition
+
+// InventoryItemDefinition is the subset of DestinyInventoryItemDefinition the plugin uses. The full
+// definitions table is very large, so only these fields are kept in memory.
+type InventoryItemDefinition struct {
+	Hash                int                                       `json:"hash"`
+	DisplayProperties   bungie.DestinyDisplayPropertiesDefinition `json:"displayProperties"`
+	ItemTypeDisplayName string                                    `json:"itemTypeDisplayName"`
+}
+
+type InventoryItemDefinitionMap map[int]*InventoryItemDefinition
+
+// RecordDefinition is the subset of DestinyRecordDefinition the plugin uses.
+type RecordDefinition struct {
+	Hash              int                                       `json:"hash"`
+	DisplayProperties bungie.DestinyDisplayPropertiesDefinition `json:"displayProperties"`
+	Scope             bungie.DestinyScope                       `json:"scope"`
+	TitleInfo         RecordTitleBlock                          `json:"titleInfo"`
+	ParentNodeHashes  []int                                     `json:"parentNodeHashes"`
+	Redacted          bool                                      `json:"redacted"`
+}
+
+type RecordDefinitionMap map[int]*RecordDefinition
+
+// RecordTitleBlock is a record's title. The manifest keys titles by gender name, such as "Male",
+// which bungie.DestinyRecordTitleBlock can't unmarshal.
+type RecordTitleBlock struct {
+	HasTitle       bool              `json:"hasTitle"`
+	TitlesByGender map[string]string `json:"titlesByGender"`
+}
+
+// Title returns the record's title, or an empty string for records without one.
+func (titleBlock RecordTitleBlock) Title() string {
+	if !titleBlock.HasTitle {
+		return ""
+	}
+
+	if title, ok := titleBlock.TitlesByGender["Male"]; ok {
+		return title
+	}
+
+	for _, title := range titleBlock.TitlesByGender {
+		return title
+	}
+
+	return ""
+}
+
+// PresentationNodeDefinition is the subset of DestinyPresentationNodeDefinition the plugin uses.
+type PresentationNodeDefinition struct {
+	Hash                 int                                         `json:"hash"`
+	DisplayProperties    bungie.DestinyDisplayPropertiesDefinition   `json:"displayProperties"`
+	Scope                bungie.DestinyScope                         `json:"scope"`
+	CompletionRecordHash int                                         `json:"completionRecordHash"`
+	Children             bungie.DestinyPresentationNodeChildrenBlock `json:"children"`
+	ParentNodeHashes     []int                                       `json:"parentNodeHashes"`
+	Redacted             bool                                        `json:"redacted"`
+}
+
+type PresentationNodeDefinitionMap map[int]*PresentationNodeDefinition
+
+// CollectibleDefinition is the subset of DestinyCollectibleDefinition the plugin uses.
+type CollectibleDefinition struct {
+	Hash              int                                       `json:"hash"`
+	DisplayProperties bungie.DestinyDisplayPropertiesDefinition `json:"displayProperties"`
+	Scope             bungie.DestinyScope                       `json:"scope"`
+	SourceString      string                                    `json:"sourceString"`
+	ItemHash          int                                       `json:"itemHash"`
+	ParentNodeHashes  []int                                     `json:"parentNodeHashes"`
+	Redacted          bool                                      `json:"redacted"`
+}
+
+type CollectibleDefinitionMap map[int]*CollectibleDefinition
+
+type DestinySeasonDefinitionMap map[int]*bungie.DestinySeasonDefinition
+type DestinySeasonPassDefinitionMap map[int]*bungie.DestinySeasonPassDefinition
+type DestinyMetricDefinitionMap map[int]*bungie.DestinyMetricDefinition
+type DestinyTraitDefinitionMap map[int]*bungie.DestinyTraitDefinition
+
+// GuardianRank is the profile's Guardian Rank, which is newer than the generated profile models.
+type GuardianRank struct {
+	CurrentGuardianRank         int `json:"currentGuardianRank"`
+	LifetimeHighestGuardianRank int `json:"lifetimeHighestGuardianRank"`
+}
+
+// profileWithGuardianRankResponse decodes a profile response along with the Guardian Rank fields of
+// its profile component, replacing the embedded response's profile component.
+type profileWithGuardianRankResponse struct {
+	bungie.DestinyProfileResponse
+	Profile struct {
+		Data struct {
+			bungie.DestinyProfileComponent
+			GuardianRank
+		} `json:"data"`
+		Privacy  bungie.ComponentPrivacySetting `json:"privacy"`
+		Disabled bool                           `json:"disabled"`
+	} `json:"profile"`
+}
+
+type exactSearchRequest struct {
+	DisplayName     string `json:"displayName"`
+	DisplayNameCode int    `json:"displayNameCode"`
+}
+
+type userSearchPrefixRequest struct {
+	DisplayNamePrefix string `json:"displayNamePrefix"`
+}
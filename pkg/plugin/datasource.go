@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
 	queryPkg "joshhunt-destiny-datasource/pkg/query"
+	"joshhunt-destiny-datasource/pkg/snapshots"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	bungie "github.com/joshhunt/bungieapigo/pkg/models"
 )
 
@@ -36,23 +39,62 @@ func NewDatasource(ctx context.Context, settings backend.DataSourceInstanceSetti
 		return &Datasource{}, nil
 	}
 
-	bungieApiClient := bungieAPI.Create(apiKey)
+	datasourceSettings, err := parseDatasourceSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := bungieAPIOptions(datasourceSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	bungieApiClient := bungieAPI.Create(apiKey, options...)
+	snapshotRetention := time.Hour * 24 * time.Duration(datasourceSettings.SnapshotRecorder.RetentionDays)
+	snapshotStore := snapshots.NewStore(snapshotDirectory(datasourceSettings, settings.UID), snapshotRetention)
+
+	var recorder *queryPkg.Recorder
+	if recorderSettings := datasourceSettings.SnapshotRecorder; recorderSettings.Enabled && len(recorderSettings.Profiles) > 0 {
+		recorder = queryPkg.NewRecorder(&bungieApiClient, snapshotStore, queryPkg.RecorderOptions{
+			Profiles:  recorderSettings.Profiles,
+			Snapshots: recorderSettings.Snapshots,
+			Interval:  time.Minute * time.Duration(recorderSettings.IntervalMinutes),
+		})
+		recorder.Start()
+	}
+
+	var trialsReportClient *http.Client
+	if datasourceSettings.ProfileSearchFallback == ProfileSearchFallbackTrialsReport {
+		trialsReportClient = newTrialsReportClient()
+	}
 
 	return &Datasource{
-		bungieAPIClient: &bungieApiClient,
+		bungieAPIClient:       &bungieApiClient,
+		profileSearchFallback: datasourceSettings.ProfileSearchFallback,
+		trialsReportClient:    trialsReportClient,
+		snapshotStore:         snapshotStore,
+		recorder:              recorder,
 	}, nil
 }
 
 // Datasource is an example datasource which can respond to data queries, reports
 // its health and has streaming skills.
 type Datasource struct {
-	bungieAPIClient *bungieAPI.BungieAPI
+	bungieAPIClient       *bungieAPI.BungieAPI
+	profileSearchFallback string
+	trialsReportClient    *http.Client
+	snapshotStore         *snapshots.Store
+	recorder              *queryPkg.Recorder
 }
 
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance
 // created. As soon as datasource settings change detected by SDK old datasource instance will
 // be disposed and a new one will be created using NewSampleDatasource factory function.
 func (d *Datasource) Dispose() {
+	if d.recorder != nil {
+		d.recorder.Stop()
+	}
+
 	d.bungieAPIClient = nil
 	// Clean up datasource instance resources.
 }
@@ -77,7 +119,7 @@ func (d *Datasource) QueryData(ctx context.Context, req *backend.QueryDataReques
 	return response, nil
 }
 
-func (d *Datasource) query(_ context.Context, pCtx backend.PluginContext, query backend.DataQuery) backend.DataResponse {
+func (d *Datasource) query(ctx context.Context, pCtx backend.PluginContext, query backend.DataQuery) backend.DataResponse {
 	// Unmarshal the JSON into our queryModel.
 	var queryModel queryPkg.QueryModel
 
@@ -91,14 +133,19 @@ func (d *Datasource) query(_ context.Context, pCtx backend.PluginContext, query
 		return backend.ErrDataResponse(backend.StatusBadRequest, "Query is invalid")
 	}
 
-	activityHistoryFrame, err := queryPkg.QueryActivityHistory(d.bungieAPIClient, query, queryModel)
+	var frames data.Frames
+	if queryModel.QueryType == queryPkg.QueryTypeSnapshots {
+		frames, err = queryPkg.QuerySnapshots(d.snapshotStore, query, queryModel)
+	} else {
+		frames, err = queryPkg.Run(ctx, d.bungieAPIClient, query, queryModel)
+	}
 
 	if err != nil {
-		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("%v", err.Error()))
+		return errorDataResponse(err)
 	}
 
 	var response backend.DataResponse
-	response.Frames = append(response.Frames, activityHistoryFrame)
+	response.Frames = append(response.Frames, frames...)
 
 	return response
 }
@@ -107,7 +154,7 @@ func (d *Datasource) query(_ context.Context, pCtx backend.PluginContext, query
 // The main use case for these health checks is the test button on the
 // datasource configuration page which allows users to verify that
 // a datasource is working as expected.
-func (d *Datasource) CheckHealth(_ context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
+func (d *Datasource) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
 	if d.bungieAPIClient == nil {
 		return &backend.CheckHealthResult{
 			Status:  backend.HealthStatusError,
@@ -115,19 +162,11 @@ func (d *Datasource) CheckHealth(_ context.Context, req *backend.CheckHealthRequ
 		}, nil
 	}
 
-	resp, err := d.bungieAPIClient.RequestProfileRaw(2, "4611686018469271298", []int{bungie.DestinyComponentTypeCharacters})
-
+	_, err := d.bungieAPIClient.RequestProfileRaw(ctx, 2, "4611686018469271298", []int{bungie.DestinyComponentTypeCharacters})
 	if err != nil {
 		return &backend.CheckHealthResult{
 			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("Health check request failed: %v", err),
-		}, nil
-	}
-
-	if resp.ErrorStatus != "Success" {
-		return &backend.CheckHealthResult{
-			Status:  backend.HealthStatusError,
-			Message: fmt.Sprintf("%v: %v", resp.ErrorStatus, resp.Message),
+			Message: healthCheckMessage(err),
 		}, nil
 	}
 
@@ -146,11 +185,17 @@ func (d *Datasource) CallResource(ctx context.Context, req *backend.CallResource
 
 	switch req.Path {
 	case "profile-search":
-		resp, err = d.profileSearchResourceHandler(req)
+		resp, err = d.profileSearchResourceHandler(ctx, req)
 	case "list-characters":
-		resp, err = d.listCharactersResourceHandler(req)
+		resp, err = d.listCharactersResourceHandler(ctx, req)
+	case "clan-search":
+		resp, err = d.clanSearchResourceHandler(ctx, req)
+	case "linked-memberships":
+		resp, err = d.linkedMembershipsResourceHandler(ctx, req)
 	case "list-activity-modes":
-		resp, err = d.listActivityModesResourceHandler(req)
+		resp, err = d.listActivityModesResourceHandler(ctx, req)
+	case "list-metrics":
+		resp, err = d.listMetricsResourceHandler(ctx, req)
 	default:
 		resp = &backend.CallResourceResponse{
 			Body:   []byte(`{ "message": "resource not found" }`),
@@ -2,6 +2,11 @@ package plugin
 
 import (
 	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -26,3 +31,64 @@ func TestQueryData(t *testing.T) {
 		t.Fatal("QueryData must return a response")
 	}
 }
+
+func TestCheckHealthInvalidAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{ "ErrorCode": 2101, "ErrorStatus": "ApiInvalidOrExpiredKey", "Message": "Invalid key" }`))
+	}))
+	defer server.Close()
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL))
+	ds := Datasource{bungieAPIClient: &client}
+
+	result, err := ds.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Status != backend.HealthStatusError || !strings.Contains(result.Message, "API key is invalid") {
+		t.Errorf("expected an invalid API key message, got %v: %v", result.Status, result.Message)
+	}
+}
+
+func TestSnapshotDirectoryPerDatasource(t *testing.T) {
+	first := snapshotDirectory(DatasourceSettings{}, "first")
+	second := snapshotDirectory(DatasourceSettings{}, "second")
+	if first == second {
+		t.Errorf("expected data sources to default to their own snapshot directories, both got %v", first)
+	}
+
+	configured := snapshotDirectory(DatasourceSettings{SnapshotDirectory: "/var/lib/snapshots"}, "first")
+	if configured != "/var/lib/snapshots" {
+		t.Errorf("expected the configured snapshot directory, got %v", configured)
+	}
+}
+
+func TestTrialsReportSearchIsSeparateFromBungie(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("x-api-key") != "" {
+			t.Errorf("expected no Bungie API key to be sent to Destiny Trials Report, got %q", r.Header.Get("x-api-key"))
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	originalURL := TRIALS_REPORT_SEARCH_URL
+	TRIALS_REPORT_SEARCH_URL = server.URL + "/players/0/%v/"
+	defer func() { TRIALS_REPORT_SEARCH_URL = originalURL }()
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL))
+	ds := Datasource{bungieAPIClient: &client, trialsReportClient: newTrialsReportClient()}
+
+	_, err := ds.searchTrialsReport(context.Background(), "Guardian")
+	if err == nil {
+		t.Fatal("expected an error for a failing search")
+	}
+
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("expected a failing search not to be retried, got %v requests", requests)
+	}
+}
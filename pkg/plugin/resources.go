@@ -1,17 +1,84 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"joshhunt-destiny-datasource/pkg/query"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
-func (d *Datasource) profileSearchResourceHandler(req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+var (
+	TRIALS_REPORT_SEARCH_URL = "https://elastic.destinytrialsreport.com/players/0/%v/"
+	// Destiny Trials Report is only a fallback, so a slow or failing search gives up quickly
+	TRIALS_REPORT_TIMEOUT = time.Second * 5
+)
+
+// newTrialsReportClient returns the client for Destiny Trials Report searches. It's kept apart
+// from the Bungie API client so the API key, rate limiter and retries stay with Bungie's requests.
+func newTrialsReportClient() *http.Client {
+	return &http.Client{Timeout: TRIALS_REPORT_TIMEOUT}
+}
+
+// searchTrialsReport searches Destiny Trials Report, normalizing results to the player's cross
+// save membership.
+func (d *Datasource) searchTrialsReport(ctx context.Context, query string) ([]bungieAPI.ProfileSearchResourceResponseItem, error) {
+	searchUrl := fmt.Sprintf(TRIALS_REPORT_SEARCH_URL, url.PathEscape(query))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := d.trialsReportClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("destiny trials report search returned status %v", res.StatusCode)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	searchResults := []trialsReportSearchResult{}
+	err = json.Unmarshal(data, &searchResults)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]bungieAPI.ProfileSearchResourceResponseItem, 0, len(searchResults))
+	for _, searchResult := range searchResults {
+		item := bungieAPI.ProfileSearchResourceResponseItem{
+			BungieName:     searchResult.BungieName,
+			DisplayName:    searchResult.DisplayName,
+			MembershipId:   searchResult.MembershipId,
+			MembershipType: searchResult.MembershipType,
+		}
+
+		if searchResult.CrossSaveOverride.MembershipType > 0 {
+			item.MembershipId = searchResult.CrossSaveOverride.MembershipId
+			item.MembershipType = searchResult.CrossSaveOverride.MembershipType
+		}
+		item.MembershipTypeName = d.bungieAPIClient.GetMembershipTypeName(item.MembershipType)
+
+		results = append(results, item)
+	}
+
+	return results, nil
+}
+
+func (d *Datasource) profileSearchResourceHandler(ctx context.Context, req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
 	requestBody := ProfileSearchResourceRequestBody{}
 	err := json.Unmarshal(req.Body, &requestBody)
 	if err != nil {
@@ -19,22 +86,65 @@ func (d *Datasource) profileSearchResourceHandler(req *backend.CallResourceReque
 		return nil, err
 	}
 
-	searchUrl := fmt.Sprintf("https://elastic.destinytrialsreport.com/players/0/%v/", url.PathEscape(requestBody.Query))
-	data, err := d.bungieAPIClient.Get(searchUrl, nil)
+	results, err := d.bungieAPIClient.SearchProfiles(ctx, requestBody.Query)
+	if err != nil {
+		logger.Error("Bungie profile search failed", "error", err)
+	}
+
+	if d.profileSearchFallback == ProfileSearchFallbackTrialsReport && len(results) == 0 {
+		results, err = d.searchTrialsReport(ctx, requestBody.Query)
+		if err != nil {
+			logger.Error("DTR profile search failed", "error", err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := json.Marshal(results)
 	if err != nil {
-		logger.Error("Unable call to DTR search failed", "error", err)
+		logger.Error("Unable to marshal profileSearchResourceHandler response", "error", err)
 		return nil, err
 	}
 
 	resp := &backend.CallResourceResponse{
 		Status: http.StatusOK,
-		Body:   data,
+		Body:   respBody,
 	}
 
 	return resp, nil
 }
 
-func (d *Datasource) listCharactersResourceHandler(req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+func (d *Datasource) clanSearchResourceHandler(ctx context.Context, req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+	requestBody := ClanSearchResourceRequestBody{}
+	err := json.Unmarshal(req.Body, &requestBody)
+	if err != nil {
+		logger.Error("Unable to unmarshal clan search body", "error", err)
+		return nil, err
+	}
+
+	clans, err := d.bungieAPIClient.SearchClans(ctx, requestBody.Query)
+	if err != nil {
+		logger.Error("Clan search failed", "error", err)
+		return nil, err
+	}
+
+	respBody, err := json.Marshal(clans)
+	if err != nil {
+		logger.Error("Unable to marshal clanSearchResourceHandler response", "error", err)
+		return nil, err
+	}
+
+	resp := &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   respBody,
+	}
+
+	return resp, nil
+}
+
+func (d *Datasource) listCharactersResourceHandler(ctx context.Context, req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
 	requestBody := ListCharactersResourceRequestBody{}
 	err := json.Unmarshal(req.Body, &requestBody)
 	if err != nil {
@@ -42,7 +152,10 @@ func (d *Datasource) listCharactersResourceHandler(req *backend.CallResourceRequ
 		return nil, err
 	}
 
-	characters, err := d.bungieAPIClient.RequestCharacterDescriptions(requestBody.MembershipType, requestBody.MembershipId)
+	// Characters of cross saved accounts only belong to the primary membership
+	membership := d.bungieAPIClient.ResolvePrimaryMembership(ctx, requestBody.MembershipPair)
+
+	characters, err := d.bungieAPIClient.RequestCharacterDescriptions(ctx, membership.MembershipType, membership.MembershipId)
 	if err != nil {
 		logger.Error("Error requesting character descriptions", "error", err, "membershipId", requestBody.MembershipId)
 		return nil, err
@@ -62,8 +175,44 @@ func (d *Datasource) listCharactersResourceHandler(req *backend.CallResourceRequ
 	return resp, nil
 }
 
-func (d *Datasource) listActivityModesResourceHandler(req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
-	allDefs := d.bungieAPIClient.GetAllActivityModeDefinitions()
+func (d *Datasource) linkedMembershipsResourceHandler(ctx context.Context, req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+	requestBody := LinkedMembershipsResourceRequestBody{}
+	err := json.Unmarshal(req.Body, &requestBody)
+	if err != nil {
+		logger.Error("Unable to unmarshal linkedMemberships body", "error", err)
+		return nil, err
+	}
+
+	memberships, err := d.bungieAPIClient.RequestLinkedMemberships(ctx, requestBody.MembershipPair)
+	if err != nil {
+		logger.Error("Error requesting linked memberships", "error", err, "membershipId", requestBody.MembershipId)
+		return nil, err
+	}
+
+	for i := range memberships {
+		memberships[i].MembershipTypeName = d.bungieAPIClient.GetMembershipTypeName(memberships[i].MembershipType)
+	}
+
+	respBody, err := json.Marshal(memberships)
+	if err != nil {
+		logger.Error("Unable to marshal linkedMembershipsResourceHandler response", "error", err)
+		return nil, err
+	}
+
+	resp := &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   respBody,
+	}
+
+	return resp, nil
+}
+
+func (d *Datasource) listActivityModesResourceHandler(ctx context.Context, req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+	allDefs, err := d.bungieAPIClient.GetAllActivityModeDefinitions(ctx)
+	if err != nil {
+		logger.Error("Unable to get activity mode definitions", "error", err)
+		return nil, err
+	}
 
 	activityModes := make([]bungieAPI.ListActivityModeResourceResponseItem, 0, len(allDefs))
 
@@ -88,3 +237,24 @@ func (d *Datasource) listActivityModesResourceHandler(req *backend.CallResourceR
 
 	return resp, nil
 }
+
+func (d *Datasource) listMetricsResourceHandler(ctx context.Context, req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+	metrics, err := query.ListMetrics(ctx, d.bungieAPIClient)
+	if err != nil {
+		logger.Error("Unable to list metrics", "error", err)
+		return nil, err
+	}
+
+	respBody, err := json.Marshal(metrics)
+	if err != nil {
+		logger.Error("Unable to marshal listMetricsResourceHandler response", "error", err)
+		return nil, err
+	}
+
+	resp := &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   respBody,
+	}
+
+	return resp, nil
+}
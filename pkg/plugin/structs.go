@@ -2,10 +2,57 @@ package plugin
 
 import bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
 
+const (
+	ProfileSearchFallbackNone = ""
+	// Search Destiny Trials Report when Bungie's search fails or finds nobody
+	ProfileSearchFallbackTrialsReport = "trialsReport"
+)
+
+// DatasourceSettings are the options from the datasource's jsonData.
+type DatasourceSettings struct {
+	BaseUrl        string `json:"baseUrl"`
+	StatsBaseUrl   string `json:"statsBaseUrl"`
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+	ProxyUrl       string `json:"proxyUrl"`
+	CacheDirectory string `json:"cacheDirectory"`
+	Language       string `json:"language"`
+
+	ProfileSearchFallback string `json:"profileSearchFallback"`
+
+	SnapshotDirectory string                   `json:"snapshotDirectory"`
+	SnapshotRecorder  SnapshotRecorderSettings `json:"snapshotRecorder"`
+}
+
+// SnapshotRecorderSettings configures the background recorder that snapshots profiles for the snapshots query.
+type SnapshotRecorderSettings struct {
+	Enabled         bool                       `json:"enabled"`
+	IntervalMinutes int                        `json:"intervalMinutes"`
+	RetentionDays   int                        `json:"retentionDays"`
+	Profiles        []bungieAPI.MembershipPair `json:"profiles"`
+	Snapshots       []string                   `json:"snapshots"`
+}
+
 type ProfileSearchResourceRequestBody struct {
 	Query string `json:"query"`
 }
 
+type ClanSearchResourceRequestBody struct {
+	Query string `json:"query"`
+}
+
+// trialsReportSearchResult is a player from Destiny Trials Report's search.
+type trialsReportSearchResult struct {
+	BungieName        string                   `json:"bungieName"`
+	DisplayName       string                   `json:"displayName"`
+	MembershipId      string                   `json:"membershipId"`
+	MembershipType    int                      `json:"membershipType"`
+	CrossSaveOverride bungieAPI.MembershipPair `json:"crossSaveOverride"`
+}
+
 type ListCharactersResourceRequestBody struct {
 	bungieAPI.MembershipPair
 }
+
+type LinkedMembershipsResourceRequestBody struct {
+	bungieAPI.MembershipPair
+}
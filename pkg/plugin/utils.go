@@ -1,8 +1,123 @@
 package plugin
 
-import "joshhunt-destiny-datasource/pkg/query"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"joshhunt-destiny-datasource/pkg/query"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func parseDatasourceSettings(settings backend.DataSourceInstanceSettings) (DatasourceSettings, error) {
+	datasourceSettings := DatasourceSettings{}
+	if len(settings.JSONData) > 0 {
+		err := json.Unmarshal(settings.JSONData, &datasourceSettings)
+		if err != nil {
+			return datasourceSettings, fmt.Errorf("unable to parse datasource settings: %w", err)
+		}
+	}
+
+	switch datasourceSettings.ProfileSearchFallback {
+	case ProfileSearchFallbackNone, ProfileSearchFallbackTrialsReport:
+	default:
+		return datasourceSettings, fmt.Errorf("unknown profile search fallback %q", datasourceSettings.ProfileSearchFallback)
+	}
+
+	for _, snapshot := range datasourceSettings.SnapshotRecorder.Snapshots {
+		if !query.IsSupportedSnapshot(snapshot) {
+			return datasourceSettings, fmt.Errorf("unknown snapshot %q", snapshot)
+		}
+	}
+
+	return datasourceSettings, nil
+}
+
+// bungieAPIOptions converts the datasource's settings into options for the Bungie API client.
+func bungieAPIOptions(datasourceSettings DatasourceSettings) ([]bungieAPI.Option, error) {
+	options := []bungieAPI.Option{}
+
+	if datasourceSettings.BaseUrl != "" {
+		options = append(options, bungieAPI.WithBaseURL(datasourceSettings.BaseUrl))
+	}
+
+	if datasourceSettings.StatsBaseUrl != "" {
+		options = append(options, bungieAPI.WithStatsBaseURL(datasourceSettings.StatsBaseUrl))
+	}
+
+	if datasourceSettings.TimeoutSeconds > 0 {
+		options = append(options, bungieAPI.WithTimeout(time.Second*time.Duration(datasourceSettings.TimeoutSeconds)))
+	}
+
+	if datasourceSettings.ProxyUrl != "" {
+		proxyURL, err := url.Parse(datasourceSettings.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+
+		options = append(options, bungieAPI.WithProxy(proxyURL))
+	}
+
+	if datasourceSettings.Language != "" {
+		if !bungieAPI.IsSupportedLocale(datasourceSettings.Language) {
+			return nil, fmt.Errorf("unsupported language %q", datasourceSettings.Language)
+		}
+
+		options = append(options, bungieAPI.WithLocale(datasourceSettings.Language))
+	}
+
+	cacheDirectory := datasourceSettings.CacheDirectory
+	if cacheDirectory == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err == nil {
+			cacheDirectory = filepath.Join(userCacheDir, "joshhunt-destiny-datasource")
+		}
+	}
+	options = append(options, bungieAPI.WithCacheDir(cacheDirectory))
+
+	return options, nil
+}
+
+// snapshotDirectory is where snapshots are stored. They're kept out of the definition cache
+// directory, as cached definitions are deleted whenever the manifest changes. By default each
+// data source gets its own directory, so data sources recording the same profile don't share
+// (and append to) the same files.
+func snapshotDirectory(datasourceSettings DatasourceSettings, datasourceUID string) string {
+	if datasourceSettings.SnapshotDirectory != "" {
+		return datasourceSettings.SnapshotDirectory
+	}
+
+	baseDir, err := os.UserConfigDir()
+	if err != nil {
+		baseDir = os.TempDir()
+	}
+
+	return filepath.Join(baseDir, "joshhunt-destiny-datasource", "snapshots", datasourceUID)
+}
 
 func validateQuery(query query.QueryModel) bool {
+	if !query.RequiresProfile() {
+		return true
+	}
+
+	if len(query.Profiles) > 0 {
+		for _, profile := range query.Profiles {
+			if profile.MembershipType == 0 || profile.MembershipId == "" {
+				return false
+			}
+		}
+
+		return true
+	}
+
 	if query.Profile.MembershipType == 0 {
 		return false
 	}
@@ -17,3 +132,56 @@ func validateQuery(query query.QueryModel) bool {
 
 	return true
 }
+
+// bungieErrorStatus returns the response status for a Bungie API error, and a plain language
+// explanation of it.
+func bungieErrorStatus(bungieError *bungieAPI.BungieError) (backend.Status, string) {
+	switch {
+	case errors.Is(bungieError, bungieAPI.ErrPrivacyRestricted):
+		return backend.StatusForbidden, "This player's Destiny activity is private. They can make it public in their Bungie.net privacy settings."
+	case errors.Is(bungieError, bungieAPI.ErrNotFound):
+		return backend.StatusNotFound, "The Destiny profile, character or activity could not be found."
+	case errors.Is(bungieError, bungieAPI.ErrThrottled):
+		return backend.StatusTooManyRequests, "The Bungie API is throttling requests. Try again shortly, or refresh fewer panels at once."
+	case errors.Is(bungieError, bungieAPI.ErrSystemDisabled):
+		return backend.Status(http.StatusServiceUnavailable), "The Bungie API is currently disabled, usually for maintenance."
+	case errors.Is(bungieError, bungieAPI.ErrInvalidAPIKey):
+		return backend.StatusUnauthorized, "The Bungie API key is invalid or has expired. Check the data source settings."
+	case errors.Is(bungieError, bungieAPI.ErrUpstream):
+		return backend.StatusBadGateway, "The Bungie API returned a server error."
+	default:
+		return backend.StatusBadGateway, "The Bungie API request failed."
+	}
+}
+
+// errorDataResponse maps an error from running a query to a response with a matching status,
+// and a frame notice explaining Bungie API failures in plain language.
+func errorDataResponse(err error) backend.DataResponse {
+	var bungieError *bungieAPI.BungieError
+	if !errors.As(err, &bungieError) {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+
+	status, notice := bungieErrorStatus(bungieError)
+
+	frame := data.NewFrame("response")
+	frame.SetMeta(&data.FrameMeta{
+		Notices: []data.Notice{{Severity: data.NoticeSeverityError, Text: notice}},
+	})
+
+	response := backend.ErrDataResponseWithSource(status, backend.ErrorSourceDownstream, err.Error())
+	response.Frames = data.Frames{frame}
+
+	return response
+}
+
+// healthCheckMessage explains why the health check request failed, in plain language for Bungie API errors.
+func healthCheckMessage(err error) string {
+	var bungieError *bungieAPI.BungieError
+	if !errors.As(err, &bungieError) {
+		return fmt.Sprintf("Health check request failed: %v", err)
+	}
+
+	_, notice := bungieErrorStatus(bungieError)
+	return fmt.Sprintf("%v (%v)", notice, bungieError)
+}
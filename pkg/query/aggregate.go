@@ -0,0 +1,300 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	PeriodTypeAllTime = "allTime"
+	PeriodTypeDaily   = "daily"
+)
+
+var (
+	DEFAULT_STATS_MODES = []int{
+		bungie.DestinyActivityModeTypeAllPvE,
+		bungie.DestinyActivityModeTypeAllPvP,
+		bungie.DestinyActivityModeTypeRaid,
+		bungie.DestinyActivityModeTypeAllStrikes,
+		bungie.DestinyActivityModeTypeGambit,
+	}
+
+	// Bungie rejects daily stats requests spanning more than 31 days
+	MAX_DAILY_STATS_DAYS = 31
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeAggregateStats, QueryAggregateStats)
+}
+
+// statsSeries is the stats for one activity mode of one character, or the whole account.
+type statsSeries struct {
+	characterName string
+	modeName      string
+	stats         bungie.DestinyHistoricalStatsByPeriod
+}
+
+// requestDailyStats requests daily stats across the time range in windows Bungie will accept,
+// merging the results for each mode.
+func requestDailyStats(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, profile bungieAPI.MembershipPair, characterId string, modes []int, timeRange backend.TimeRange) (map[string]bungie.DestinyHistoricalStatsByPeriod, error) {
+	merged := map[string]bungie.DestinyHistoricalStatsByPeriod{}
+	window := time.Hour * 24 * time.Duration(MAX_DAILY_STATS_DAYS-1)
+
+	for dayStart := timeRange.From; !dayStart.After(timeRange.To); dayStart = dayStart.Add(window + time.Hour*24) {
+		dayEnd := dayStart.Add(window)
+		if dayEnd.After(timeRange.To) {
+			dayEnd = timeRange.To
+		}
+
+		statsByMode, err := bungieAPIClient.RequestCharacterStats(ctx, profile.MembershipType, profile.MembershipId, characterId, modes, bungie.PeriodTypeDaily, dayStart, dayEnd)
+		if err != nil {
+			return nil, err
+		}
+
+		for modeKey, stats := range statsByMode {
+			mergedStats := merged[modeKey]
+			mergedStats.Daily = append(mergedStats.Daily, stats.Daily...)
+			merged[modeKey] = mergedStats
+		}
+	}
+
+	return merged, nil
+}
+
+// requestAllTimeAccountStats requests account wide lifetime stats for each mode. The account stats
+// endpoint includes deleted characters, but only reports some modes, so the rest come from the
+// stats of all of the account's current characters.
+func requestAllTimeAccountStats(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, membership bungieAPI.MembershipPair, modes []int) (map[string]bungie.DestinyHistoricalStatsByPeriod, error) {
+	accountStats, err := bungieAPIClient.RequestAccountStats(ctx, membership.MembershipType, membership.MembershipId)
+	if err != nil {
+		return nil, err
+	}
+
+	statsByMode := map[string]bungie.DestinyHistoricalStatsByPeriod{}
+	remainingModes := []int{}
+
+	for _, mode := range modes {
+		modeDef, err := bungieAPIClient.GetActivityModeDefinitionForModeType(ctx, mode)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get activity mode definitions: %w", err)
+		}
+
+		if modeDef != nil {
+			if stats, ok := accountStats.MergedAllCharacters.Results[modeDef.FriendlyName]; ok && len(stats.AllTime) > 0 {
+				statsByMode[modeDef.FriendlyName] = stats
+				continue
+			}
+		}
+
+		remainingModes = append(remainingModes, mode)
+	}
+
+	if len(remainingModes) == 0 {
+		return statsByMode, nil
+	}
+
+	characterStats, err := bungieAPIClient.RequestCharacterStats(ctx, membership.MembershipType, membership.MembershipId, "0", remainingModes, bungie.PeriodTypeAllTime, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	for modeKey, stats := range characterStats {
+		statsByMode[modeKey] = stats
+	}
+
+	return statsByMode, nil
+}
+
+func QueryAggregateStats(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	periodType := queryModel.PeriodType
+	if periodType == "" {
+		periodType = PeriodTypeAllTime
+	}
+
+	if periodType != PeriodTypeAllTime && periodType != PeriodTypeDaily {
+		return nil, fmt.Errorf("unknown period type %q", periodType)
+	}
+
+	modes := queryModel.Modes
+	if len(modes) == 0 {
+		modes = DEFAULT_STATS_MODES
+	}
+
+	// The account wide stats of each membership, or each character's stats when split by character
+	statsCharacters := []queryCharacter{}
+	characterNames := map[queryCharacter]string{}
+	splitByCharacter := queryModel.SplitBy == SplitByCharacter
+	accountWide := !splitByCharacter
+
+	if splitByCharacter {
+		statsCharacters = queryModel.characters()
+
+		names, err := requestCharacterNames(ctx, bungieAPIClient, statsCharacters, queryModel.profileErrors)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, character := range statsCharacters {
+			characterNames[character] = characterLabel(character, names)
+		}
+	} else {
+		statsCharacters = queryModel.accounts()
+		for _, account := range statsCharacters {
+			membershipName := bungieAPIClient.GetMembershipTypeName(account.membership.MembershipType)
+
+			switch {
+			case account.player != "" && queryModel.AllLinkedMemberships:
+				characterNames[account] = fmt.Sprintf("%v (%v)", account.player, membershipName)
+			case account.player != "":
+				characterNames[account] = account.player
+			default:
+				characterNames[account] = membershipName
+			}
+		}
+
+		// Stats can't be merged across memberships or players, so each gets its own rows
+		splitByCharacter = len(statsCharacters) > 1
+	}
+
+	allSeries := []statsSeries{}
+
+	for _, character := range statsCharacters {
+		var statsByMode map[string]bungie.DestinyHistoricalStatsByPeriod
+		var err error
+
+		switch {
+		case periodType == PeriodTypeDaily:
+			statsByMode, err = requestDailyStats(ctx, bungieAPIClient, character.membership, character.characterId, modes, dataQuery.TimeRange)
+		case accountWide:
+			statsByMode, err = requestAllTimeAccountStats(ctx, bungieAPIClient, character.membership, modes)
+		default:
+			statsByMode, err = bungieAPIClient.RequestCharacterStats(ctx, character.membership.MembershipType, character.membership.MembershipId, character.characterId, modes, bungie.PeriodTypeAllTime, time.Time{}, time.Time{})
+		}
+		if err != nil && queryModel.profileErrors != nil {
+			// Leave out the player's stats rather than failing every profile of the query
+			queryModel.profileErrors.add(character.player, fmt.Errorf("unable to get stats: %w", err))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get stats: %w", err)
+		}
+
+		characterName := characterNames[character]
+		if characterName == "" {
+			characterName = character.characterId
+		}
+
+		for modeKey, stats := range statsByMode {
+			modeName := modeKey
+			modeDef, err := bungieAPIClient.GetActivityModeDefinitionForFriendlyName(ctx, modeKey)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get activity mode definitions: %w", err)
+			}
+			if modeDef != nil {
+				modeName = modeDef.DisplayProperties.Name
+			}
+
+			allSeries = append(allSeries, statsSeries{characterName: characterName, modeName: modeName, stats: stats})
+		}
+	}
+
+	sort.Slice(allSeries, func(i, j int) bool {
+		if allSeries[i].characterName != allSeries[j].characterName {
+			return allSeries[i].characterName < allSeries[j].characterName
+		}
+
+		return allSeries[i].modeName < allSeries[j].modeName
+	})
+
+	stats := queryModel.Stats
+	if len(stats) == 0 {
+		stats = []string{StatsAll}
+	}
+
+	var frames data.Frames
+	var err error
+	if periodType == PeriodTypeDaily {
+		frames, err = dailyStatsFrames(ctx, bungieAPIClient, allSeries, stats, splitByCharacter)
+	} else {
+		frames, err = allTimeStatsFrames(ctx, bungieAPIClient, allSeries, stats, splitByCharacter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return addProfileNoticesToFrames(frames, queryModel.profileErrors), nil
+}
+
+// allTimeStatsFrames returns a table with a row for each mode (and character), and a column for each stat.
+func allTimeStatsFrames(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, allSeries []statsSeries, stats []string, splitByCharacter bool) (data.Frames, error) {
+	characterField := data.NewField("Character", nil, []string{})
+	modeField := data.NewField("Mode", nil, []string{})
+
+	// Wrap the lifetime stats as period groups so they share the stat column handling with activity history
+	rows := make([]bungie.DestinyHistoricalStatsPeriodGroup, 0, len(allSeries))
+	for _, series := range allSeries {
+		characterField.Append(series.characterName)
+		modeField.Append(series.modeName)
+		rows = append(rows, bungie.DestinyHistoricalStatsPeriodGroup{Values: series.stats.AllTime})
+	}
+
+	statFields, err := statFields(ctx, bungieAPIClient, stats, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := data.NewFrame("response")
+	if splitByCharacter {
+		frame.Fields = append(frame.Fields, characterField)
+	}
+	frame.Fields = append(frame.Fields, modeField)
+	frame.Fields = append(frame.Fields, statFields...)
+
+	return data.Frames{frame}, nil
+}
+
+// dailyStatsFrames returns a time series frame for each mode (and character), labelled by the mode.
+func dailyStatsFrames(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, allSeries []statsSeries, stats []string, splitByCharacter bool) (data.Frames, error) {
+	frames := data.Frames{}
+
+	for _, series := range allSeries {
+		days := series.stats.Daily
+		sort.Slice(days, func(i, j int) bool {
+			return days[i].Period.Before(days[j].Period)
+		})
+
+		labels := data.Labels{"mode": series.modeName}
+		if splitByCharacter {
+			labels[SplitByCharacter] = series.characterName
+		}
+
+		timeField := data.NewField("Time", nil, []time.Time{})
+		for _, day := range days {
+			timeField.Append(day.Period)
+		}
+
+		statFields, err := statFields(ctx, bungieAPIClient, stats, days)
+		if err != nil {
+			return nil, err
+		}
+
+		frame := data.NewFrame("response", timeField)
+		for _, field := range statFields {
+			field.Labels = labels
+			frame.Fields = append(frame.Fields, field)
+		}
+		frame.SetMeta(&data.FrameMeta{Type: data.FrameTypeTimeSeriesWide})
+
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
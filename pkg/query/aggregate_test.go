@@ -0,0 +1,46 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"testing"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+func TestAllTimeAccountStats(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Account/1/Stats/": `{ "mergedAllCharacters": { "results": {
+			"allPvE": { "allTime": { "kills": { "basic": { "value": 100 } } } },
+			"allPvP": {}
+		} } }`,
+		"/Platform/Destiny2/3/Account/1/Character/0/Stats/": `{
+			"allPvP": { "allTime": { "kills": { "basic": { "value": 20 } } } },
+			"raid": { "allTime": { "kills": { "basic": { "value": 30 } } } }
+		}`,
+	}, map[string]string{
+		"DestinyActivityModeDefinition": `{
+			"1": { "hash": 1, "modeType": 7, "friendlyName": "allPvE" },
+			"2": { "hash": 2, "modeType": 5, "friendlyName": "allPvP" },
+			"3": { "hash": 3, "modeType": 4, "friendlyName": "raid" }
+		}`,
+	})
+
+	modes := []int{bungie.DestinyActivityModeTypeAllPvE, bungie.DestinyActivityModeTypeAllPvP, bungie.DestinyActivityModeTypeRaid}
+	statsByMode, err := requestAllTimeAccountStats(context.Background(), client, bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"}, modes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PvE comes from the account stats, and the modes it has no stats for from the characters' stats
+	expectedKills := map[string]float64{"allPvE": 100, "allPvP": 20, "raid": 30}
+	if len(statsByMode) != len(expectedKills) {
+		t.Fatalf("unexpected modes %v", statsByMode)
+	}
+
+	for modeKey, kills := range expectedKills {
+		if value := statsByMode[modeKey].AllTime["kills"].Basic.Value; value != kills {
+			t.Errorf("expected %v kills for %v, got %v", kills, modeKey, value)
+		}
+	}
+}
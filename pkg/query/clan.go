@@ -0,0 +1,140 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+	"strconv"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	// Display text for clan ranks, indexed by Bungie's RuntimeGroupMemberType
+	CLAN_RANKS = []string{"None", "Beginner", "Member", "Admin", "Acting founder", "Founder"}
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeClanRoster, QueryClanRoster)
+}
+
+func clanMemberProfile(member bungie.GroupMember) QueryProfile {
+	userInfo := member.DestinyUserInfo
+	bungieName := bungieAPI.FormatBungieName(bungie.UserInfoCard{
+		DisplayName:                 userInfo.DisplayName,
+		BungieGlobalDisplayName:     userInfo.BungieGlobalDisplayName,
+		BungieGlobalDisplayNameCode: userInfo.BungieGlobalDisplayNameCode,
+	})
+
+	return QueryProfile{
+		MembershipPair: bungieAPI.MembershipPair{
+			MembershipType: int(userInfo.MembershipType),
+			MembershipId:   strconv.FormatInt(userInfo.MembershipId, 10),
+		},
+		BungieName: bungieName,
+	}
+}
+
+// QueryClanRoster returns the clan's members and, when the query asks for them, the combined
+// activity history of every member over the time range.
+func QueryClanRoster(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	if queryModel.ClanId == "" {
+		return nil, errors.New("a clan is required")
+	}
+
+	members, err := bungieAPIClient.RequestGroupMembers(ctx, queryModel.ClanId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get clan members: %w", err)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].JoinDate.Before(members[j].JoinDate)
+	})
+
+	frames := data.Frames{clanRosterFrame(members)}
+
+	if !queryModel.IncludeActivities || len(members) == 0 {
+		return frames, nil
+	}
+
+	queryModel.Profiles = make([]QueryProfile, 0, len(members))
+	for _, member := range members {
+		queryModel.Profiles = append(queryModel.Profiles, clanMemberProfile(member))
+	}
+
+	// Every character of each member, rather than a selection from the query's profile
+	queryModel.Characters = nil
+	activityFrame, err := queryClanActivities(ctx, bungieAPIClient, dataQuery, queryModel)
+	if err != nil {
+		// The roster is still useful without the members' activities
+		frames[0].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("unable to get member activities: %v", err),
+		})
+
+		return frames, nil
+	}
+
+	return append(frames, activityFrame), nil
+}
+
+// queryClanActivities returns the activity history of every character of the clan members in the
+// query's profiles.
+func queryClanActivities(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (*data.Frame, error) {
+	queryModel, err := resolveProfile(ctx, bungieAPIClient, queryModel)
+	if err != nil {
+		return nil, err
+	}
+
+	activityFrame, err := QueryActivityHistory(ctx, bungieAPIClient, dataQuery, queryModel)
+	if err != nil {
+		return nil, err
+	}
+	activityFrame.Name = "activities"
+
+	return activityFrame, nil
+}
+
+func clanRosterFrame(members []bungie.GroupMember) *data.Frame {
+	nameField := data.NewField("Name", nil, []string{})
+	rankField := data.NewField("Rank", nil, []string{})
+	joinDateField := data.NewField("Join date", nil, []time.Time{})
+	lastOnlineField := data.NewField("Last online", nil, []*time.Time{})
+	onlineField := data.NewField("Online", nil, []bool{})
+
+	for _, member := range members {
+		nameField.Append(clanMemberProfile(member).BungieName)
+
+		rank := CLAN_RANKS[0]
+		if int(member.MemberType) < len(CLAN_RANKS) {
+			rank = CLAN_RANKS[member.MemberType]
+		}
+		rankField.Append(rank)
+
+		joinDateField.Append(member.JoinDate)
+
+		// Members who have never been online since joining have no status change
+		if member.LastOnlineStatusChange > 0 {
+			lastOnline := time.Unix(member.LastOnlineStatusChange, 0).UTC()
+			lastOnlineField.Append(&lastOnline)
+		} else {
+			lastOnlineField.Append(nil)
+		}
+
+		onlineField.Append(member.IsOnline)
+	}
+
+	return data.NewFrame("roster",
+		nameField,
+		rankField,
+		joinDateField,
+		lastOnlineField,
+		onlineField,
+	)
+}
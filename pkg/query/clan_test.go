@@ -0,0 +1,81 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestClanRoster(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Platform/GroupV2/123/Members/" {
+			t.Errorf("unexpected request to %v", r.URL.Path)
+		}
+
+		w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "hasMore": false, "results": [
+			{ "memberType": 5, "isOnline": false, "lastOnlineStatusChange": "0", "joinDate": "2020-01-01T00:00:00Z",
+				"destinyUserInfo": { "membershipType": 3, "membershipId": "1", "bungieGlobalDisplayName": "Founder", "bungieGlobalDisplayNameCode": 1 } },
+			{ "memberType": 2, "isOnline": true, "lastOnlineStatusChange": "1700000000", "joinDate": "2021-01-01T00:00:00Z",
+				"destinyUserInfo": { "membershipType": 3, "membershipId": "2", "bungieGlobalDisplayName": "Member", "bungieGlobalDisplayNameCode": 22 } }
+		] } }`))
+	}))
+	defer server.Close()
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL))
+
+	frames, err := Run(context.Background(), &client, backend.DataQuery{RefID: "A"}, QueryModel{QueryType: QueryTypeClanRoster, ClanId: "123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 1 {
+		t.Fatalf("expected only the roster frame without activities, got %v frames", len(frames))
+	}
+
+	roster := frames[0]
+	if roster.Rows() != 2 {
+		t.Fatalf("expected a row per member, got %v", roster.Rows())
+	}
+
+	if name := roster.Fields[0].At(1); name != "Member#0022" {
+		t.Errorf("expected members sorted by join date with Bungie Names, got %v", name)
+	}
+
+	if lastOnline := roster.Fields[3].At(0); !roster.Fields[3].NilAt(0) {
+		t.Errorf("expected no last online time for a member who has never been online, got %v", lastOnline)
+	}
+}
+
+func TestClanRosterWithoutMemberActivities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Platform/GroupV2/123/Members/" {
+			w.Write([]byte(`{ "ErrorCode": 1665, "ErrorStatus": "DestinyPrivacyRestriction", "Message": "Private" }`))
+			return
+		}
+
+		w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "hasMore": false, "results": [
+			{ "memberType": 5, "joinDate": "2020-01-01T00:00:00Z",
+				"destinyUserInfo": { "membershipType": 3, "membershipId": "1", "bungieGlobalDisplayName": "Founder", "bungieGlobalDisplayNameCode": 1 } }
+		] } }`))
+	}))
+	defer server.Close()
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL))
+
+	frames, err := Run(context.Background(), &client, backend.DataQuery{RefID: "A"}, QueryModel{QueryType: QueryTypeClanRoster, ClanId: "123", IncludeActivities: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 1 || frames[0].Rows() != 1 {
+		t.Fatalf("expected the roster without activities, got %v", frames)
+	}
+
+	if meta := frames[0].Meta; meta == nil || len(meta.Notices) != 1 {
+		t.Errorf("expected a notice that member activities are missing, got %+v", meta)
+	}
+}
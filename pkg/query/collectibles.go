@@ -0,0 +1,124 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	COLLECTIBLES_COMPONENTS = []int{
+		bungie.DestinyComponentTypeProfiles,
+		bungie.DestinyComponentTypeCollectibles,
+	}
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeCollectibles, QueryCollectibles)
+}
+
+// QueryCollectibles returns each collectible beneath the query's presentation node, or beneath the
+// collections root when no node is given, along with a summary of acquired collectibles per category.
+func QueryCollectibles(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	profiles, err := requestPresentationProfiles(ctx, bungieAPIClient, queryModel, COLLECTIBLES_COMPONENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	collectibleDefs, err := bungieAPIClient.GetCollectibleDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get collectible definitions: %w", err)
+	}
+
+	nodeDefs, err := bungieAPIClient.GetPresentationNodeDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get presentation node definitions: %w", err)
+	}
+
+	includePlayerColumn := len(queryModel.Profiles) > 1
+
+	playerField := data.NewField("Player", nil, []string{})
+	categoryField := data.NewField("Category", nil, []string{})
+	collectibleField := data.NewField("Collectible", nil, []string{})
+	sourceField := data.NewField("Source", nil, []string{})
+	acquiredField := data.NewField("Acquired", nil, []bool{})
+
+	summaryPlayerField := data.NewField("Player", nil, []string{})
+	summaryCategoryField := data.NewField("Category", nil, []string{})
+	summaryAcquiredField := data.NewField("Acquired", nil, []int64{})
+	summaryTotalField := data.NewField("Total", nil, []int64{})
+	summaryPercentField := data.NewField("Percent acquired", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+
+	for _, collections := range profiles {
+		rootNodeHash := queryModel.PresentationNodeHash
+		if rootNodeHash == 0 {
+			rootNodeHash = collections.profile.ProfileCollectibles.Data.CollectionCategoriesRootNodeHash
+		}
+
+		for _, nodeDef := range nodesUnderNode(nodeDefs, rootNodeHash) {
+			var acquired, total int64
+
+			for _, child := range nodeDef.Children.Collectibles {
+				collectibleDef := collectibleDefs[child.CollectibleHash]
+				if collectibleDef == nil || collectibleDef.Redacted {
+					continue
+				}
+
+				collectible, ok := collections.collectible(collectibleDef)
+				if !ok || collectible.State&bungie.DestinyCollectibleStateInvisible != 0 {
+					continue
+				}
+
+				isAcquired := collectible.State&bungie.DestinyCollectibleStateNotAcquired == 0
+				total += 1
+				if isAcquired {
+					acquired += 1
+				}
+
+				playerField.Append(collections.player)
+				categoryField.Append(nodeDef.DisplayProperties.Name)
+				collectibleField.Append(collectibleDef.DisplayProperties.Name)
+				sourceField.Append(collectibleDef.SourceString)
+				acquiredField.Append(isAcquired)
+			}
+
+			// Only nodes holding collectibles themselves are categories worth summarising
+			if total == 0 {
+				continue
+			}
+
+			summaryPlayerField.Append(collections.player)
+			summaryCategoryField.Append(nodeDef.DisplayProperties.Name)
+			summaryAcquiredField.Append(acquired)
+			summaryTotalField.Append(total)
+			summaryPercentField.Append(progressRatio(acquired, total))
+		}
+	}
+
+	collectiblesFrame := data.NewFrame("collectibles")
+	summaryFrame := data.NewFrame("summary")
+	if includePlayerColumn {
+		collectiblesFrame.Fields = append(collectiblesFrame.Fields, playerField)
+		summaryFrame.Fields = append(summaryFrame.Fields, summaryPlayerField)
+	}
+	collectiblesFrame.Fields = append(collectiblesFrame.Fields,
+		categoryField,
+		collectibleField,
+		sourceField,
+		acquiredField,
+	)
+	summaryFrame.Fields = append(summaryFrame.Fields,
+		summaryCategoryField,
+		summaryAcquiredField,
+		summaryTotalField,
+		summaryPercentField,
+	)
+	addProfileNotices(collectiblesFrame, queryModel.profileErrors)
+
+	return data.Frames{collectiblesFrame, summaryFrame}, nil
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestCollectiblesAcquiredStateAndSummary(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/1/": `{
+			"profile": { "data": { "characterIds": [10] } },
+			"profileCollectibles": { "data": {
+				"collectionCategoriesRootNodeHash": 100,
+				"collectibles": { "1": { "state": 0 }, "2": { "state": 1 }, "3": { "state": 4 }, "4": { "state": 0 } }
+			} },
+			"characterCollectibles": { "data": { "10": { "collectibles": { "5": { "state": 0 } } } } }
+		}`,
+	}, map[string]string{
+		"DestinyPresentationNodeDefinition": `{
+			"100": { "hash": 100, "displayProperties": { "name": "Collections" }, "children": { "presentationNodes": [{ "presentationNodeHash": 101 }, { "presentationNodeHash": 102 }] } },
+			"101": { "hash": 101, "displayProperties": { "name": "Weapons" }, "children": { "collectibles": [{ "collectibleHash": 1 }, { "collectibleHash": 2 }, { "collectibleHash": 3 }, { "collectibleHash": 4 }] } },
+			"102": { "hash": 102, "displayProperties": { "name": "Armor" }, "children": { "collectibles": [{ "collectibleHash": 5 }] } }
+		}`,
+		"DestinyCollectibleDefinition": `{
+			"1": { "hash": 1, "displayProperties": { "name": "Acquired weapon" }, "sourceString": "Source: Raid" },
+			"2": { "hash": 2, "displayProperties": { "name": "Missing weapon" } },
+			"3": { "hash": 3, "displayProperties": { "name": "Invisible weapon" } },
+			"4": { "hash": 4, "redacted": true },
+			"5": { "hash": 5, "scope": 1, "displayProperties": { "name": "Character armor" } }
+		}`,
+	})
+
+	queryModel := QueryModel{
+		QueryType: QueryTypeCollectibles,
+		Profile:   bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+	}
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("expected collectibles and summary frames, got %v", len(frames))
+	}
+
+	// Invisible and redacted collectibles are left out, and character scoped ones come from the character
+	collectibles := frames[0]
+	expectedRows := [][]any{
+		{"Weapons", "Acquired weapon", "Source: Raid", true},
+		{"Weapons", "Missing weapon", "", false},
+		{"Armor", "Character armor", "", true},
+	}
+	if collectibles.Rows() != len(expectedRows) {
+		t.Fatalf("expected %v collectibles, got %v", len(expectedRows), collectibles.Rows())
+	}
+	for i, expected := range expectedRows {
+		row := collectibles.RowCopy(i)
+		for j := range expected {
+			if row[j] != expected[j] {
+				t.Errorf("expected collectible row %v to be %v, got %v", i, expected, row)
+				break
+			}
+		}
+	}
+
+	// The root node holds no collectibles of its own, so it has no summary row
+	summary := frames[1]
+	expectedSummary := [][]any{
+		{"Weapons", int64(1), int64(2), 0.5},
+		{"Armor", int64(1), int64(1), 1.0},
+	}
+	if summary.Rows() != len(expectedSummary) {
+		t.Fatalf("expected a summary row per category, got %v", summary.Rows())
+	}
+	for i, expected := range expectedSummary {
+		row := summary.RowCopy(i)
+		for j := range expected {
+			if row[j] != expected[j] {
+				t.Errorf("expected summary row %v to be %v, got %v", i, expected, row)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// runConcurrently calls fn for every index in [0, count), with at most limit calls running at once.
+// The first failure cancels the remaining calls, and is returned rather than the cancellations it caused.
+func runConcurrently(ctx context.Context, count int, limit int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, count)
+
+	var wg sync.WaitGroup
+	workerSlots := make(chan struct{}, limit)
+
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			select {
+			case workerSlots <- struct{}{}:
+				defer func() { <-workerSlots }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			err := fn(ctx, i)
+			if err != nil {
+				errs[i] = err
+				// No point continuing if the query is going to fail anyway
+				cancel()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	var firstErr error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if firstErr == nil || (errors.Is(firstErr, context.Canceled) && !errors.Is(err, context.Canceled)) {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
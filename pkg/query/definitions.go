@@ -0,0 +1,37 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+)
+
+// activityName returns the display name of the activity definition, or an empty string if
+// Bungie doesn't have a definition for the hash.
+func activityName(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, hash int) (string, error) {
+	def, err := bungieAPIClient.GetActivityDefinitionForHash(ctx, hash)
+	if err != nil {
+		return "", fmt.Errorf("unable to get activity definitions: %w", err)
+	}
+
+	if def == nil {
+		return "", nil
+	}
+
+	return def.DisplayProperties.Name, nil
+}
+
+// activityModeName returns the display name of the activity mode, or an empty string if
+// Bungie doesn't have a definition for the mode type.
+func activityModeName(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, modeType int) (string, error) {
+	def, err := bungieAPIClient.GetActivityModeDefinitionForModeType(ctx, modeType)
+	if err != nil {
+		return "", fmt.Errorf("unable to get activity mode definitions: %w", err)
+	}
+
+	if def == nil {
+		return "", nil
+	}
+
+	return def.DisplayProperties.Name, nil
+}
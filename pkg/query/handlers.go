@@ -0,0 +1,75 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	QueryTypeActivityHistory       = "activityHistory"
+	QueryTypePostGameCarnageReport = "postGameCarnageReport"
+	QueryTypeActivityTimeSeries    = "activityTimeSeries"
+	QueryTypeAggregateStats        = "aggregateStats"
+	QueryTypeWeaponUsage           = "weaponUsage"
+	QueryTypeClanRoster            = "clanRoster"
+	QueryTypeProfileSnapshot       = "profileSnapshot"
+	QueryTypeTriumphs              = "triumphs"
+	QueryTypeCollectibles          = "collectibles"
+	QueryTypeProgressions          = "progressions"
+	QueryTypeSnapshots             = "snapshots"
+	QueryTypeMetrics               = "metrics"
+)
+
+// QueryHandler runs a single query of a given query type and returns the frames for its response.
+type QueryHandler func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error)
+
+var queryHandlers = map[string]QueryHandler{}
+
+// RegisterQueryHandler makes a handler available for the given query type. Handlers are
+// expected to register themselves from an init function in this package.
+func RegisterQueryHandler(queryType string, handler QueryHandler) {
+	if _, exists := queryHandlers[queryType]; exists {
+		panic(fmt.Sprintf("query handler already registered for query type %q", queryType))
+	}
+
+	queryHandlers[queryType] = handler
+}
+
+// Run dispatches the query to the handler registered for its query type. Queries without a
+// query type are treated as activity history queries, which was the only kind before query types existed.
+func Run(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	queryType := queryModel.QueryType
+	if queryType == "" {
+		queryType = QueryTypeActivityHistory
+	}
+
+	handler, ok := queryHandlers[queryType]
+	if !ok {
+		return nil, fmt.Errorf("unknown query type %q", queryType)
+	}
+
+	if queryModel.Language != "" {
+		if !bungieAPI.IsSupportedLocale(queryModel.Language) {
+			return nil, fmt.Errorf("unsupported language %q", queryModel.Language)
+		}
+
+		if bungieAPIClient != nil {
+			localizedClient := bungieAPIClient.ForLocale(queryModel.Language)
+			bungieAPIClient = &localizedClient
+		}
+	}
+
+	if bungieAPIClient != nil && queryModel.RequiresProfile() {
+		var err error
+		queryModel, err = resolveProfile(ctx, bungieAPIClient, queryModel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return handler(ctx, bungieAPIClient, dataQuery, queryModel)
+}
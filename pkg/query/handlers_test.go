@@ -0,0 +1,15 @@
+package query
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestRunUnknownQueryType(t *testing.T) {
+	_, err := Run(context.Background(), nil, backend.DataQuery{RefID: "A"}, QueryModel{QueryType: "notARealQueryType"})
+	if err == nil {
+		t.Fatal("Run must return an error for an unknown query type")
+	}
+}
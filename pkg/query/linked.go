@@ -0,0 +1,197 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+)
+
+// queryCharacter is one of the characters a query runs against, with the membership it belongs to.
+type queryCharacter struct {
+	membership  bungieAPI.MembershipPair
+	characterId string
+	// The player's name, for queries comparing multiple profiles
+	player string
+}
+
+// characters returns the characters the query runs against, across every profile and linked
+// membership the query targets.
+func (queryModel QueryModel) characters() []queryCharacter {
+	if queryModel.resolvedCharacters != nil {
+		return queryModel.resolvedCharacters
+	}
+
+	characters := make([]queryCharacter, 0, len(queryModel.Characters))
+	for _, characterId := range queryModel.Characters {
+		characters = append(characters, queryCharacter{membership: queryModel.Profile, characterId: characterId})
+	}
+
+	return characters
+}
+
+// accounts returns a character for each membership the query runs against, using Bungie's
+// character "0" shorthand for all of the membership's characters.
+func (queryModel QueryModel) accounts() []queryCharacter {
+	if queryModel.resolvedCharacters == nil {
+		return []queryCharacter{{membership: queryModel.Profile, characterId: "0"}}
+	}
+
+	seen := map[bungieAPI.MembershipPair]bool{}
+	accounts := []queryCharacter{}
+	for _, character := range queryModel.resolvedCharacters {
+		if !seen[character.membership] {
+			seen[character.membership] = true
+			accounts = append(accounts, queryCharacter{membership: character.membership, characterId: "0", player: character.player})
+		}
+	}
+
+	return accounts
+}
+
+// requestAllCharacters returns every character of the membership, or of all of its linked
+// memberships when allLinkedMemberships is set.
+func requestAllCharacters(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, membership bungieAPI.MembershipPair, allLinkedMemberships bool, player string) ([]queryCharacter, error) {
+	memberships := []bungieAPI.MembershipPair{membership}
+
+	if allLinkedMemberships {
+		var err error
+		memberships, err = bungieAPIClient.RequestActiveLinkedMemberships(ctx, membership)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get linked memberships: %w", err)
+		}
+	}
+
+	characters := []queryCharacter{}
+	for _, membership := range memberships {
+		characterDescriptions, err := bungieAPIClient.RequestCharacterDescriptions(ctx, membership.MembershipType, membership.MembershipId)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get characters: %w", err)
+		}
+
+		for _, characterDescription := range characterDescriptions {
+			characters = append(characters, queryCharacter{membership: membership, characterId: characterDescription.CharacterId, player: player})
+		}
+	}
+
+	return characters, nil
+}
+
+// resolveQueryProfile returns the characters a profile of a multi-profile query runs against: the
+// selected characters of its primary membership, or all of its characters when none are selected.
+func resolveQueryProfile(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, profile QueryProfile, allLinkedMemberships bool) ([]queryCharacter, error) {
+	player := profile.playerName()
+
+	primaryMembership := bungieAPIClient.ResolvePrimaryMembership(ctx, profile.MembershipPair)
+
+	if allLinkedMemberships || len(profile.Characters) == 0 {
+		return requestAllCharacters(ctx, bungieAPIClient, primaryMembership, allLinkedMemberships, player)
+	}
+
+	characters := make([]queryCharacter, 0, len(profile.Characters))
+	for _, characterId := range profile.Characters {
+		characters = append(characters, queryCharacter{membership: primaryMembership, characterId: characterId, player: player})
+	}
+
+	return characters, nil
+}
+
+// resolveProfile points the query at the profile's cross save primary membership, as other
+// memberships of a cross saved account have no Destiny data of their own. When the query targets
+// all linked memberships, it runs against every character of each of them instead.
+//
+// Queries with multiple profiles resolve each of them separately, recording a profile's errors
+// rather than failing the query unless every profile fails.
+func resolveProfile(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, queryModel QueryModel) (QueryModel, error) {
+	if len(queryModel.Profiles) > 0 {
+		queryModel.profileErrors = &profileErrors{}
+		charactersByProfile := make([][]queryCharacter, len(queryModel.Profiles))
+		resolveErrors := make([]error, len(queryModel.Profiles))
+
+		// Errors are kept per profile, so no profile stops the others from resolving
+		err := runConcurrently(ctx, len(queryModel.Profiles), MAX_CONCURRENT_PROFILES, func(ctx context.Context, i int) error {
+			charactersByProfile[i], resolveErrors[i] = resolveQueryProfile(ctx, bungieAPIClient, queryModel.Profiles[i], queryModel.AllLinkedMemberships)
+			return nil
+		})
+		if err != nil {
+			return queryModel, err
+		}
+
+		queryModel.resolvedCharacters = []queryCharacter{}
+		failedProfiles := 0
+		for i, profile := range queryModel.Profiles {
+			if resolveErrors[i] != nil {
+				queryModel.profileErrors.add(profile.playerName(), resolveErrors[i])
+				failedProfiles += 1
+				continue
+			}
+
+			queryModel.resolvedCharacters = append(queryModel.resolvedCharacters, charactersByProfile[i]...)
+		}
+
+		if failedProfiles == len(queryModel.Profiles) {
+			return queryModel, errors.Join(resolveErrors...)
+		}
+
+		return queryModel, nil
+	}
+
+	if queryModel.AllLinkedMemberships {
+		characters, err := requestAllCharacters(ctx, bungieAPIClient, queryModel.Profile, true, "")
+		if err != nil {
+			return queryModel, err
+		}
+
+		queryModel.resolvedCharacters = characters
+
+		return queryModel, nil
+	}
+
+	queryModel.Profile = bungieAPIClient.ResolvePrimaryMembership(ctx, queryModel.Profile)
+
+	return queryModel, nil
+}
+
+// requestCharacterNames returns the display name of each of the characters, keyed by character ID.
+// Failures are recorded in profileErrors when the query has multiple profiles.
+func requestCharacterNames(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, characters []queryCharacter, profileErrors *profileErrors) (map[string]string, error) {
+	characterNames := map[string]string{}
+	requestedMemberships := map[bungieAPI.MembershipPair]bool{}
+
+	for _, character := range characters {
+		if requestedMemberships[character.membership] {
+			continue
+		}
+		requestedMemberships[character.membership] = true
+
+		characterDescriptions, err := bungieAPIClient.RequestCharacterDescriptions(ctx, character.membership.MembershipType, character.membership.MembershipId)
+		if err != nil && profileErrors != nil {
+			profileErrors.add(character.player, fmt.Errorf("unable to get characters: %w", err))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get characters: %w", err)
+		}
+
+		for _, characterDescription := range characterDescriptions {
+			characterNames[characterDescription.CharacterId] = characterDescription.Description
+		}
+	}
+
+	return characterNames, nil
+}
+
+// characterLabel names the character for labels and columns, prefixed with the player's name in
+// queries comparing multiple profiles.
+func characterLabel(character queryCharacter, characterNames map[string]string) string {
+	name, ok := characterNames[character.characterId]
+	if !ok {
+		name = character.characterId
+	}
+
+	if character.player != "" {
+		return fmt.Sprintf("%v %v", character.player, name)
+	}
+
+	return name
+}
@@ -0,0 +1,164 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+	"strings"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	METRICS_COMPONENTS = []int{
+		bungie.DestinyComponentTypeProfiles,
+		bungie.DestinyComponentTypeMetrics,
+	}
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeMetrics, QueryMetrics)
+}
+
+// describeMetrics returns every metric with its category, the name of its parent presentation node,
+// and the names of its traits, sorted by category and then name.
+func describeMetrics(metricDefs bungieAPI.DestinyMetricDefinitionMap, nodeDefs bungieAPI.PresentationNodeDefinitionMap, traitDefs bungieAPI.DestinyTraitDefinitionMap) []bungieAPI.ListMetricResourceResponseItem {
+	metrics := make([]bungieAPI.ListMetricResourceResponseItem, 0, len(metricDefs))
+
+	for _, metricDef := range metricDefs {
+		if metricDef.Redacted || metricDef.DisplayProperties.Name == "" {
+			continue
+		}
+
+		var category string
+		if len(metricDef.ParentNodeHashes) > 0 {
+			if nodeDef := nodeDefs[metricDef.ParentNodeHashes[0]]; nodeDef != nil {
+				category = nodeDef.DisplayProperties.Name
+			}
+		}
+
+		traits := []string{}
+		for i, traitHash := range metricDef.TraitHashes {
+			if traitDef := traitDefs[traitHash]; traitDef != nil && traitDef.DisplayProperties.Name != "" {
+				traits = append(traits, traitDef.DisplayProperties.Name)
+			} else if i < len(metricDef.TraitIds) {
+				traits = append(traits, metricDef.TraitIds[i])
+			}
+		}
+
+		metrics = append(metrics, bungieAPI.ListMetricResourceResponseItem{
+			Value:       metricDef.Hash,
+			Label:       metricDef.DisplayProperties.Name,
+			Description: metricDef.DisplayProperties.Description,
+			Category:    category,
+			Traits:      traits,
+		})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].Category != metrics[j].Category {
+			return metrics[i].Category < metrics[j].Category
+		}
+		if metrics[i].Label != metrics[j].Label {
+			return metrics[i].Label < metrics[j].Label
+		}
+		return metrics[i].Value < metrics[j].Value
+	})
+
+	return metrics
+}
+
+// ListMetrics returns every metric a metrics query can select.
+func ListMetrics(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI) ([]bungieAPI.ListMetricResourceResponseItem, error) {
+	metricDefs, err := bungieAPIClient.GetMetricDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get metric definitions: %w", err)
+	}
+
+	nodeDefs, err := bungieAPIClient.GetPresentationNodeDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get presentation node definitions: %w", err)
+	}
+
+	traitDefs, err := bungieAPIClient.GetTraitDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get trait definitions: %w", err)
+	}
+
+	return describeMetrics(metricDefs, nodeDefs, traitDefs), nil
+}
+
+// QueryMetrics returns the current value and objective of the query's metrics, or of every visible
+// metric when none are selected, with a row per metric.
+func QueryMetrics(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	profiles, err := requestPresentationProfiles(ctx, bungieAPIClient, queryModel, METRICS_COMPONENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := ListMetrics(ctx, bungieAPIClient)
+	if err != nil {
+		return nil, err
+	}
+
+	selectedMetrics := map[int]bool{}
+	for _, metricHash := range queryModel.MetricHashes {
+		selectedMetrics[metricHash] = true
+	}
+
+	includePlayerColumn := len(queryModel.Profiles) > 1
+
+	playerField := data.NewField("Player", nil, []string{})
+	categoryField := data.NewField("Category", nil, []string{})
+	metricField := data.NewField("Metric", nil, []string{})
+	traitsField := data.NewField("Traits", nil, []string{})
+	valueField := data.NewField("Value", nil, []int64{})
+	objectiveField := data.NewField("Objective", nil, []int64{})
+	percentField := data.NewField("Percent complete", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+
+	for _, metricsProfile := range profiles {
+		profileMetrics := metricsProfile.profile.Metrics.Data.Metrics
+
+		for _, metric := range metrics {
+			if len(selectedMetrics) > 0 && !selectedMetrics[metric.Value] {
+				continue
+			}
+
+			profileMetric, ok := profileMetrics[metric.Value]
+			if !ok || (profileMetric.Invisible && len(selectedMetrics) == 0) {
+				continue
+			}
+
+			value := int64(profileMetric.ObjectiveProgress.Progress)
+			objective := int64(profileMetric.ObjectiveProgress.CompletionValue)
+
+			playerField.Append(metricsProfile.player)
+			categoryField.Append(metric.Category)
+			metricField.Append(metric.Label)
+			traitsField.Append(strings.Join(metric.Traits, ", "))
+			valueField.Append(value)
+			objectiveField.Append(objective)
+			percentField.Append(progressRatio(value, objective))
+		}
+	}
+
+	frame := data.NewFrame("response")
+	if includePlayerColumn {
+		frame.Fields = append(frame.Fields, playerField)
+	}
+	frame.Fields = append(frame.Fields,
+		categoryField,
+		metricField,
+		traitsField,
+		valueField,
+		objectiveField,
+		percentField,
+	)
+	addProfileNotices(frame, queryModel.profileErrors)
+
+	return data.Frames{frame}, nil
+}
@@ -0,0 +1,37 @@
+package query
+
+import (
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"testing"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+func TestDescribeMetricsResolvesCategoryAndTraits(t *testing.T) {
+	metricDefs := bungieAPI.DestinyMetricDefinitionMap{
+		1: {Hash: 1, DisplayProperties: bungie.DestinyDisplayPropertiesDefinition{Name: "Raid clears"}, ParentNodeHashes: []int{10}, TraitHashes: []int{20, 21}, TraitIds: []string{"season.all", "metric.raid"}},
+		2: {Hash: 2, DisplayProperties: bungie.DestinyDisplayPropertiesDefinition{Name: "Flawless tickets"}, ParentNodeHashes: []int{11}},
+		3: {Hash: 3, Redacted: true},
+	}
+	nodeDefs := bungieAPI.PresentationNodeDefinitionMap{
+		10: {Hash: 10, DisplayProperties: bungie.DestinyDisplayPropertiesDefinition{Name: "Raids"}},
+		11: {Hash: 11, DisplayProperties: bungie.DestinyDisplayPropertiesDefinition{Name: "Crucible"}},
+	}
+	traitDefs := bungieAPI.DestinyTraitDefinitionMap{
+		20: {Hash: 20, DisplayProperties: bungie.DestinyDisplayPropertiesDefinition{Name: "All seasons"}},
+	}
+
+	metrics := describeMetrics(metricDefs, nodeDefs, traitDefs)
+	if len(metrics) != 2 {
+		t.Fatalf("expected the redacted metric to be left out, got %+v", metrics)
+	}
+
+	if metrics[0].Label != "Flawless tickets" || metrics[0].Category != "Crucible" {
+		t.Errorf("expected metrics sorted by category, got %+v", metrics)
+	}
+
+	raidClears := metrics[1]
+	if raidClears.Category != "Raids" || len(raidClears.Traits) != 2 || raidClears.Traits[0] != "All seasons" || raidClears.Traits[1] != "metric.raid" {
+		t.Errorf("expected trait names, falling back to trait IDs, got %+v", raidClears)
+	}
+}
@@ -0,0 +1,195 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+	"strconv"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypePostGameCarnageReport, func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+		frame, err := QueryPostGameCarnageReports(ctx, bungieAPIClient, dataQuery, queryModel)
+		if err != nil {
+			return nil, err
+		}
+
+		return data.Frames{frame}, nil
+	})
+}
+
+// requestInstanceIds returns the PGCR IDs the query asks for, or when none are given,
+// the IDs of every activity in the profile's activity history for the time range.
+func requestInstanceIds(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) ([]int64, error) {
+	instanceIds := []int64{}
+
+	if len(queryModel.InstanceIds) > 0 {
+		for _, rawInstanceId := range queryModel.InstanceIds {
+			instanceId, err := strconv.ParseInt(rawInstanceId, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PGCR ID %q", rawInstanceId)
+			}
+
+			instanceIds = append(instanceIds, instanceId)
+		}
+
+		return instanceIds, nil
+	}
+
+	activityHistoryByCharacter, err := requestActivityHistoryByCharacter(ctx, bungieAPIClient, queryModel, dataQuery.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	allActivityHistory := []bungie.DestinyHistoricalStatsPeriodGroup{}
+	for _, activityHistory := range activityHistoryByCharacter {
+		allActivityHistory = append(allActivityHistory, activityHistory...)
+	}
+
+	sort.Slice(allActivityHistory, func(i, j int) bool {
+		return allActivityHistory[i].Period.After(allActivityHistory[j].Period)
+	})
+
+	seen := map[int64]bool{}
+	for _, activity := range allActivityHistory {
+		instanceId := activity.ActivityDetails.InstanceId
+		if seen[instanceId] {
+			continue
+		}
+
+		seen[instanceId] = true
+		instanceIds = append(instanceIds, instanceId)
+	}
+
+	return instanceIds, nil
+}
+
+// requestPostGameCarnageReports fetches the PGCRs in parallel, returned in the same order as instanceIds.
+func requestPostGameCarnageReports(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, instanceIds []int64) ([]*bungie.DestinyPostGameCarnageReportData, error) {
+	pgcrs := make([]*bungie.DestinyPostGameCarnageReportData, len(instanceIds))
+
+	err := runConcurrently(ctx, len(instanceIds), MAX_CONCURRENT_PGCRS, func(ctx context.Context, i int) error {
+		pgcr, err := bungieAPIClient.RequestPostGameCarnageReport(ctx, instanceIds[i])
+		if err != nil {
+			return fmt.Errorf("unable to get PGCR %v: %w", instanceIds[i], err)
+		}
+
+		pgcrs[i] = pgcr
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pgcrs, nil
+}
+
+func QueryPostGameCarnageReports(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (*data.Frame, error) {
+	instanceIds, err := requestInstanceIds(ctx, bungieAPIClient, dataQuery, queryModel)
+	if err != nil {
+		return nil, err
+	}
+
+	timeField := data.NewField("Time", nil, []time.Time{})
+	instanceIDField := data.NewField("PGCR ID", nil, []int64{})
+	activityNameField := data.NewField("Activity", nil, []string{})
+
+	bungieNameField := data.NewField("Bungie name", nil, []string{})
+	classField := data.NewField("Class", nil, []string{})
+	teamField := data.NewField("Team", nil, []string{})
+
+	killsField := data.NewField("Kills", nil, []int64{})
+	deathsField := data.NewField("Deaths", nil, []int64{})
+	assistsField := data.NewField("Assists", nil, []int64{})
+	scoreField := data.NewField("Score", nil, []int64{})
+	weaponKillsField := data.NewField("Weapon kills", nil, []int64{})
+
+	completedField := data.NewField("Completed", nil, []bool{})
+	timePlayedField := data.NewField("Time played", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "s"})
+
+	includeTeam := false
+
+	pgcrs, err := requestPostGameCarnageReports(ctx, bungieAPIClient, instanceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, pgcr := range pgcrs {
+		instanceId := instanceIds[i]
+
+		teamNames := map[int]string{}
+		for _, team := range pgcr.Teams {
+			teamNames[team.TeamId] = team.TeamName
+		}
+
+		name, err := activityName(ctx, bungieAPIClient, pgcr.ActivityDetails.ReferenceId)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range pgcr.Entries {
+			timeField.Append(pgcr.Period)
+			instanceIDField.Append(instanceId)
+			activityNameField.Append(name)
+
+			bungieNameField.Append(bungieAPI.FormatBungieName(entry.Player.DestinyUserInfo))
+			classField.Append(entry.Player.CharacterClass)
+
+			teamName := ""
+			if team, ok := entry.Values["team"]; ok {
+				teamName = teamNames[int(team.Basic.Value)]
+			}
+			if teamName != "" {
+				includeTeam = true
+			}
+			teamField.Append(teamName)
+
+			killsField.Append(int64(entry.Values["kills"].Basic.Value))
+			deathsField.Append(int64(entry.Values["deaths"].Basic.Value))
+			assistsField.Append(int64(entry.Values["assists"].Basic.Value))
+			scoreField.Append(int64(entry.Score.Basic.Value))
+
+			var weaponKills int64
+			for _, weapon := range entry.Extended.Weapons {
+				weaponKills += int64(weapon.Values["uniqueWeaponKills"].Basic.Value)
+			}
+			weaponKillsField.Append(weaponKills)
+
+			completedField.Append(entry.Values["completed"].Basic.Value == 1)
+			timePlayedField.Append(int64(entry.Values["timePlayedSeconds"].Basic.Value))
+		}
+	}
+
+	frame := data.NewFrame("response")
+	frame.Fields = append(frame.Fields,
+		timeField,
+		instanceIDField,
+		activityNameField,
+		bungieNameField,
+		classField,
+	)
+
+	if includeTeam {
+		frame.Fields = append(frame.Fields, teamField)
+	}
+
+	frame.Fields = append(frame.Fields,
+		killsField,
+		deathsField,
+		assistsField,
+		scoreField,
+		completedField,
+		timePlayedField,
+		weaponKillsField,
+	)
+	addProfileNotices(frame, queryModel.profileErrors)
+
+	return frame, nil
+}
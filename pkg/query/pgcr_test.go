@@ -0,0 +1,129 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// newFakeBungieClient returns a client for a fake Bungie API serving responses by request path, wrapped
+// in Bungie's response envelope. Definition tables are served from the manifest, and are empty unless
+// given in tables. Only the first page of paged endpoints has any results.
+func newFakeBungieClient(t *testing.T, responses map[string]string, tables map[string]string) *bungieAPI.BungieAPI {
+	t.Helper()
+
+	tableNames := []string{
+		"DestinyActivityDefinition",
+		"DestinyActivityModeDefinition",
+		"DestinyHistoricalStatsDefinition",
+		"DestinyInventoryItemDefinition",
+	}
+	for tableName := range tables {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+
+	tablePaths := []string{}
+	for _, tableName := range tableNames {
+		tablePaths = append(tablePaths, fmt.Sprintf("%q: %q", tableName, "/tables/"+tableName+".json"))
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tableName, ok := strings.CutPrefix(r.URL.Path, "/tables/"); ok {
+			table, ok := tables[strings.TrimSuffix(tableName, ".json")]
+			if !ok {
+				table = "{}"
+			}
+			w.Write([]byte(table))
+			return
+		}
+
+		if r.URL.Path == "/Platform/Destiny2/Manifest/" {
+			fmt.Fprintf(w, `{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": "test", "jsonWorldComponentContentPaths": { "en": { %v } } } }`, strings.Join(tablePaths, ", "))
+			return
+		}
+
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request to %v", r.URL.Path)
+			w.Write([]byte(`{ "ErrorCode": 7, "ErrorStatus": "ParameterParseFailure", "Message": "Not found" }`))
+			return
+		}
+
+		if page := r.URL.Query().Get("page"); page != "" && page != "0" {
+			response = "{}"
+		}
+
+		fmt.Fprintf(w, `{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": %v }`, response)
+	}))
+	t.Cleanup(server.Close)
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL), bungieAPI.WithStatsBaseURL(server.URL))
+	return &client
+}
+
+func fieldNames(frame *data.Frame) []string {
+	names := []string{}
+	for _, field := range frame.Fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+func TestPostGameCarnageReportsByInstanceId(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/Stats/PostGameCarnageReport/100/": `{
+			"period": "2024-01-01T00:00:00Z", "activityDetails": { "referenceId": 5 },
+			"teams": [{ "teamId": 17, "teamName": "Alpha" }],
+			"entries": [
+				{ "player": { "destinyUserInfo": { "displayName": "Old", "bungieGlobalDisplayName": "Guardian", "bungieGlobalDisplayNameCode": 7 }, "characterClass": "Hunter" },
+					"score": { "basic": { "value": 30 } },
+					"values": { "team": { "basic": { "value": 17 } }, "kills": { "basic": { "value": 12 } }, "deaths": { "basic": { "value": 3 } }, "completed": { "basic": { "value": 1 } }, "timePlayedSeconds": { "basic": { "value": 600 } } },
+					"extended": { "weapons": [{ "values": { "uniqueWeaponKills": { "basic": { "value": 8 } } } }, { "values": { "uniqueWeaponKills": { "basic": { "value": 2 } } } }] } },
+				{ "player": { "destinyUserInfo": { "displayName": "Console name" }, "characterClass": "Titan" },
+					"values": { "kills": { "basic": { "value": 4 } } } }
+			]
+		}`,
+	}, map[string]string{
+		"DestinyActivityDefinition": `{ "5": { "hash": 5, "displayProperties": { "name": "Vault of Glass" } } }`,
+	})
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, QueryModel{QueryType: QueryTypePostGameCarnageReport, InstanceIds: []string{"100"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	expectedFields := []string{"Time", "PGCR ID", "Activity", "Bungie name", "Class", "Team", "Kills", "Deaths", "Assists", "Score", "Completed", "Time played", "Weapon kills"}
+	if strings.Join(fieldNames(frame), ",") != strings.Join(expectedFields, ",") {
+		t.Fatalf("unexpected fields %v", fieldNames(frame))
+	}
+
+	if frame.Rows() != 2 {
+		t.Fatalf("expected a row per player, got %v", frame.Rows())
+	}
+
+	row := frame.RowCopy(0)
+	if row[2] != "Vault of Glass" || row[3] != "Guardian#0007" || row[5] != "Alpha" || row[6] != int64(12) || row[10] != true || row[12] != int64(10) {
+		t.Errorf("unexpected first row %v", row)
+	}
+
+	if name := frame.Fields[3].At(1); name != "Console name" {
+		t.Errorf("expected players without a Bungie Name to use their display name, got %v", name)
+	}
+}
+
+func TestPostGameCarnageReportsInvalidInstanceId(t *testing.T) {
+	_, err := Run(context.Background(), nil, backend.DataQuery{RefID: "A"}, QueryModel{QueryType: QueryTypePostGameCarnageReport, InstanceIds: []string{"not-a-number"}})
+	if err == nil || !strings.Contains(err.Error(), "invalid PGCR ID") {
+		t.Errorf("expected an invalid PGCR ID error, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"strconv"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+// presentationProfile is a profile's records, collectibles and presentation nodes, with the
+// character used for anything character scoped.
+type presentationProfile struct {
+	player       string
+	membership   bungieAPI.MembershipPair
+	profile      *bungie.DestinyProfileResponse
+	guardianRank *bungieAPI.GuardianRank
+	characterId  int64
+}
+
+func (presentation presentationProfile) record(recordDef *bungieAPI.RecordDefinition) (bungie.DestinyRecordComponent, bool) {
+	if recordDef.Scope == bungie.DestinyScopeCharacter {
+		record, ok := presentation.profile.CharacterRecords.Data[presentation.characterId].Records[recordDef.Hash]
+		return record, ok
+	}
+
+	record, ok := presentation.profile.ProfileRecords.Data.Records[recordDef.Hash]
+	return record, ok
+}
+
+func (presentation presentationProfile) collectible(collectibleDef *bungieAPI.CollectibleDefinition) (bungie.DestinyCollectibleComponent, bool) {
+	if collectibleDef.Scope == bungie.DestinyScopeCharacter {
+		collectible, ok := presentation.profile.CharacterCollectibles.Data[presentation.characterId].Collectibles[collectibleDef.Hash]
+		return collectible, ok
+	}
+
+	collectible, ok := presentation.profile.ProfileCollectibles.Data.Collectibles[collectibleDef.Hash]
+	return collectible, ok
+}
+
+func (presentation presentationProfile) presentationNode(nodeDef *bungieAPI.PresentationNodeDefinition) (bungie.DestinyPresentationNodeComponent, bool) {
+	if nodeDef.Scope == bungie.DestinyScopeCharacter {
+		node, ok := presentation.profile.CharacterPresentationNodes.Data[presentation.characterId].Nodes[nodeDef.Hash]
+		return node, ok
+	}
+
+	node, ok := presentation.profile.ProfilePresentationNodes.Data.Nodes[nodeDef.Hash]
+	return node, ok
+}
+
+// requestPresentationProfiles requests the components for each of the query's profiles. Character
+// scoped data comes from the first selected character, or the profile's first character.
+func requestPresentationProfiles(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, queryModel QueryModel, components []int) ([]presentationProfile, error) {
+	selected := selectedCharacterIds(queryModel)
+	accounts := queryModel.accounts()
+	accountProfiles := make([]*presentationProfile, len(accounts))
+
+	err := runConcurrently(ctx, len(accounts), MAX_CONCURRENT_PROFILES, func(ctx context.Context, i int) error {
+		account := accounts[i]
+		profile, guardianRank, err := bungieAPIClient.RequestProfileWithGuardianRank(ctx, account.membership.MembershipType, account.membership.MembershipId, components)
+		if err != nil && queryModel.profileErrors != nil {
+			queryModel.profileErrors.add(account.player, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var characterId int64
+		for _, profileCharacterId := range profile.Profile.Data.CharacterIds {
+			if len(selected[account.membership]) == 0 || selected[account.membership][strconv.FormatInt(profileCharacterId, 10)] {
+				characterId = profileCharacterId
+				break
+			}
+		}
+
+		accountProfiles[i] = &presentationProfile{player: account.player, membership: account.membership, profile: profile, guardianRank: guardianRank, characterId: characterId}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get profile: %w", err)
+	}
+
+	// Profiles that failed are left out, keeping the rest in the query's order
+	profiles := []presentationProfile{}
+	for _, profile := range accountProfiles {
+		if profile != nil {
+			profiles = append(profiles, *profile)
+		}
+	}
+
+	return profiles, nil
+}
+
+// nodesUnderNode returns the presentation node and all of its descendants, parents before children.
+func nodesUnderNode(nodeDefs bungieAPI.PresentationNodeDefinitionMap, nodeHash int) []*bungieAPI.PresentationNodeDefinition {
+	nodes := []*bungieAPI.PresentationNodeDefinition{}
+	seen := map[int]bool{}
+
+	var visit func(nodeHash int)
+	visit = func(nodeHash int) {
+		nodeDef := nodeDefs[nodeHash]
+		if nodeDef == nil || seen[nodeHash] {
+			return
+		}
+		seen[nodeHash] = true
+
+		nodes = append(nodes, nodeDef)
+		for _, child := range nodeDef.Children.PresentationNodes {
+			visit(child.PresentationNodeHash)
+		}
+	}
+	visit(nodeHash)
+
+	return nodes
+}
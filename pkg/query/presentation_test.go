@@ -0,0 +1,37 @@
+package query
+
+import (
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"testing"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+func TestNodesUnderNode(t *testing.T) {
+	childNodes := func(hashes ...int) bungie.DestinyPresentationNodeChildrenBlock {
+		children := bungie.DestinyPresentationNodeChildrenBlock{}
+		for _, hash := range hashes {
+			children.PresentationNodes = append(children.PresentationNodes, bungie.DestinyPresentationNodeChildEntry{PresentationNodeHash: hash})
+		}
+		return children
+	}
+
+	nodeDefs := bungieAPI.PresentationNodeDefinitionMap{
+		1: {Hash: 1, Children: childNodes(2, 3)},
+		2: {Hash: 2, Children: childNodes(4)},
+		3: {Hash: 3},
+		// Points back at the root, which must not be visited twice
+		4: {Hash: 4, Children: childNodes(1)},
+	}
+
+	nodes := nodesUnderNode(nodeDefs, 1)
+
+	hashes := []int{}
+	for _, node := range nodes {
+		hashes = append(hashes, node.Hash)
+	}
+
+	if len(hashes) != 4 || hashes[0] != 1 || hashes[1] != 2 || hashes[2] != 4 || hashes[3] != 3 {
+		t.Errorf("expected nodes depth first from the root, got %v", hashes)
+	}
+}
@@ -0,0 +1,133 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"strconv"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	PROFILE_SNAPSHOT_COMPONENTS = []int{
+		bungie.DestinyComponentTypeProfiles,
+		bungie.DestinyComponentTypeCharacters,
+		bungie.DestinyComponentTypeCharacterProgressions,
+	}
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeProfileSnapshot, QueryProfileSnapshot)
+}
+
+// selectedCharacterIds returns the characters selected for each membership of the query. Memberships
+// without any selected characters are left out, and return all of their characters.
+func selectedCharacterIds(queryModel QueryModel) map[bungieAPI.MembershipPair]map[string]bool {
+	selected := map[bungieAPI.MembershipPair]map[string]bool{}
+
+	for _, character := range queryModel.characters() {
+		if selected[character.membership] == nil {
+			selected[character.membership] = map[string]bool{}
+		}
+
+		selected[character.membership][character.characterId] = true
+	}
+
+	return selected
+}
+
+// QueryProfileSnapshot returns the current state of each character, with a row per character.
+func QueryProfileSnapshot(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	accounts := queryModel.accounts()
+	profiles := make([]*bungie.DestinyProfileResponse, len(accounts))
+
+	err := runConcurrently(ctx, len(accounts), MAX_CONCURRENT_PROFILES, func(ctx context.Context, i int) error {
+		account := accounts[i]
+		profile, err := bungieAPIClient.RequestProfile(ctx, account.membership.MembershipType, account.membership.MembershipId, PROFILE_SNAPSHOT_COMPONENTS)
+		if err != nil && queryModel.profileErrors != nil {
+			queryModel.profileErrors.add(account.player, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		profiles[i] = profile
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get profile: %w", err)
+	}
+
+	selected := selectedCharacterIds(queryModel)
+	includePlayerColumn := len(queryModel.Profiles) > 1
+
+	playerField := data.NewField("Player", nil, []string{})
+	characterIdField := data.NewField("Character ID", nil, []string{})
+	classField := data.NewField("Class", nil, []string{})
+	raceField := data.NewField("Race", nil, []string{})
+	lightField := data.NewField("Light", nil, []int64{})
+	levelField := data.NewField("Level", nil, []int64{})
+	artifactPointsField := data.NewField("Artifact points", nil, []int64{})
+	emblemField := data.NewField("Emblem", nil, []string{})
+	timePlayedField := data.NewField("Time played", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "m"})
+	lastPlayedField := data.NewField("Last played", nil, []time.Time{})
+
+	for i, profile := range profiles {
+		if profile == nil {
+			continue
+		}
+
+		account := accounts[i]
+		selectedCharacters := selected[account.membership]
+
+		// The profile component lists characters in the same order as the game
+		for _, characterId := range profile.Profile.Data.CharacterIds {
+			formattedCharacterId := strconv.FormatInt(characterId, 10)
+			if len(selectedCharacters) > 0 && !selectedCharacters[formattedCharacterId] {
+				continue
+			}
+
+			character, ok := profile.Characters.Data[characterId]
+			if !ok {
+				continue
+			}
+			progression := profile.CharacterProgressions.Data[characterId]
+
+			playerField.Append(account.player)
+			characterIdField.Append(formattedCharacterId)
+			classField.Append(bungieAPIClient.GetClassTypeName(character.ClassType))
+			raceField.Append(bungieAPIClient.GetRaceTypeName(character.RaceType))
+			lightField.Append(int64(character.Light))
+			levelField.Append(int64(character.LevelProgression.Level))
+			artifactPointsField.Append(int64(progression.SeasonalArtifact.PointsUsed))
+			emblemField.Append(bungieAPI.ImageURL(character.EmblemPath))
+			timePlayedField.Append(character.MinutesPlayedTotal)
+			lastPlayedField.Append(character.DateLastPlayed)
+		}
+	}
+
+	frame := data.NewFrame("response")
+	if includePlayerColumn {
+		frame.Fields = append(frame.Fields, playerField)
+	}
+	frame.Fields = append(frame.Fields,
+		characterIdField,
+		classField,
+		raceField,
+		lightField,
+		levelField,
+		artifactPointsField,
+		emblemField,
+		timePlayedField,
+		lastPlayedField,
+	)
+	addProfileNotices(frame, queryModel.profileErrors)
+
+	return data.Frames{frame}, nil
+}
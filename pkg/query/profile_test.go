@@ -0,0 +1,115 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+var testProfileResponse = `{
+	"profile": { "data": { "characterIds": [11, 10, 12] } },
+	"characters": { "data": {
+		"10": { "characterId": "10", "classType": 2, "light": 1800, "levelProgression": { "level": 50 }, "minutesPlayedTotal": "600", "dateLastPlayed": "2024-01-01T00:00:00Z" },
+		"11": { "characterId": "11", "classType": 1, "light": 1810, "levelProgression": { "level": 50 }, "minutesPlayedTotal": "60", "dateLastPlayed": "2024-01-02T00:00:00Z" },
+		"12": { "characterId": "12", "classType": 0, "light": 1790, "levelProgression": { "level": 50 }, "minutesPlayedTotal": "6", "dateLastPlayed": "2024-01-03T00:00:00Z" }
+	} },
+	"characterProgressions": { "data": {
+		"11": { "seasonalArtifact": { "pointsUsed": 12 } }
+	} }
+}`
+
+func TestProfileSnapshot(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/1/":                testProfileResponse,
+	}, nil)
+
+	queryModel := QueryModel{
+		QueryType: QueryTypeProfileSnapshot,
+		Profile:   bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+	}
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	expectedFields := []string{"Character ID", "Class", "Race", "Light", "Level", "Artifact points", "Emblem", "Time played", "Last played"}
+	if strings.Join(fieldNames(frame), ",") != strings.Join(expectedFields, ",") {
+		t.Fatalf("unexpected fields %v", fieldNames(frame))
+	}
+
+	// Without a selection, every character is returned in the game's order
+	expectedCharacters := []string{"11", "10", "12"}
+	if frame.Rows() != len(expectedCharacters) {
+		t.Fatalf("expected a row per character, got %v", frame.Rows())
+	}
+	for i, characterId := range expectedCharacters {
+		if frame.Fields[0].At(i) != characterId {
+			t.Errorf("expected character %v in row %v, got %v", characterId, i, frame.Fields[0].At(i))
+		}
+	}
+
+	row := frame.RowCopy(0)
+	if row[1] != "Hunter" || row[3] != int64(1810) || row[5] != int64(12) || row[7] != int64(60) {
+		t.Errorf("unexpected first row %v", row)
+	}
+}
+
+func TestProfileSnapshotSelectedCharacters(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/1/":                testProfileResponse,
+	}, nil)
+
+	queryModel := QueryModel{
+		QueryType:  QueryTypeProfileSnapshot,
+		Profile:    bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+		Characters: []string{"12", "10"},
+	}
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	if frame.Rows() != 2 || frame.Fields[0].At(0) != "10" || frame.Fields[0].At(1) != "12" {
+		t.Errorf("expected only the selected characters, in the game's order, got %v", frame.Fields[0])
+	}
+}
+
+func TestProfileSnapshotComparingPlayers(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/2/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/1/":                testProfileResponse,
+		"/Platform/Destiny2/3/Profile/2/":                testProfileResponse,
+	}, nil)
+
+	queryModel := QueryModel{
+		QueryType: QueryTypeProfileSnapshot,
+		Profiles: []QueryProfile{
+			{MembershipPair: bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"}, BungieName: "First#0001", Characters: []string{"10"}},
+			{MembershipPair: bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "2"}, BungieName: "Second#0002", Characters: []string{"11"}},
+		},
+	}
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	if fieldNames(frame)[0] != "Player" {
+		t.Fatalf("expected a player column when comparing players, got %v", fieldNames(frame))
+	}
+
+	if frame.Rows() != 2 || frame.RowCopy(0)[0] != "First#0001" || frame.RowCopy(0)[1] != "10" || frame.RowCopy(1)[0] != "Second#0002" || frame.RowCopy(1)[1] != "11" {
+		t.Errorf("expected each player's selected character, got %v %v", frame.Fields[0], frame.Fields[1])
+	}
+}
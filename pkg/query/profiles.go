@@ -0,0 +1,100 @@
+package query
+
+import (
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// QueryProfile is one of the players a multi-profile query compares, with an optional selection
+// of their characters.
+type QueryProfile struct {
+	bungieAPI.MembershipPair
+	BungieName string   `json:"bungieName"`
+	Characters []string `json:"characters"`
+}
+
+func (profile QueryProfile) playerName() string {
+	if profile.BungieName != "" {
+		return profile.BungieName
+	}
+
+	return profile.MembershipId
+}
+
+// profileErrors collects the errors of individual profiles in a multi-profile query, so one private
+// or missing profile doesn't fail the whole query.
+type profileErrors struct {
+	mu     sync.Mutex
+	errors map[string]error
+	// Players in the order their errors were added, to keep notices stable
+	players []string
+}
+
+func (profileErrors *profileErrors) add(player string, err error) {
+	if profileErrors == nil {
+		return
+	}
+
+	profileErrors.mu.Lock()
+	defer profileErrors.mu.Unlock()
+
+	if profileErrors.errors == nil {
+		profileErrors.errors = map[string]error{}
+	}
+
+	if _, exists := profileErrors.errors[player]; !exists {
+		profileErrors.players = append(profileErrors.players, player)
+		profileErrors.errors[player] = err
+	}
+}
+
+// notices returns a warning notice for each profile that failed.
+func (profileErrors *profileErrors) notices() []data.Notice {
+	if profileErrors == nil {
+		return nil
+	}
+
+	profileErrors.mu.Lock()
+	defer profileErrors.mu.Unlock()
+
+	notices := []data.Notice{}
+	for _, player := range profileErrors.players {
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%v: %v", player, profileErrors.errors[player]),
+		})
+	}
+
+	return notices
+}
+
+// addProfileNotices adds a notice to the frame for each profile of the query that failed.
+func addProfileNotices(frame *data.Frame, profileErrors *profileErrors) {
+	notices := profileErrors.notices()
+	if len(notices) == 0 {
+		return
+	}
+
+	if frame.Meta == nil {
+		frame.SetMeta(&data.FrameMeta{})
+	}
+	frame.Meta.Notices = append(frame.Meta.Notices, notices...)
+}
+
+// addProfileNoticesToFrames adds the profile notices to the first of the frames, adding an empty
+// frame to hold them when there are no others.
+func addProfileNoticesToFrames(frames data.Frames, profileErrors *profileErrors) data.Frames {
+	if len(profileErrors.notices()) == 0 {
+		return frames
+	}
+
+	if len(frames) == 0 {
+		frames = append(frames, data.NewFrame("response"))
+	}
+	addProfileNotices(frames[0], profileErrors)
+
+	return frames
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestActivityHistoryReportsProfileErrorsPerProfile(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/LinkedProfiles/"):
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "profiles": [] } }`))
+		case strings.Contains(r.URL.Path, "/Account/2/"):
+			w.Write([]byte(`{ "ErrorCode": 1665, "ErrorStatus": "DestinyPrivacyRestriction", "Message": "Private" }`))
+		case r.URL.Query().Get("page") == "0":
+			fmt.Fprintf(w, `{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "activities": [{ "period": %q, "values": {} }] } }`, now.Add(-time.Hour).Format(time.RFC3339))
+		default:
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": {} }`))
+		}
+	}))
+	defer server.Close()
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL))
+	dataQuery := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: now.Add(-time.Hour * 24), To: now}}
+	queryModel := QueryModel{
+		Reduce: ReduceTotal,
+		Profiles: []QueryProfile{
+			{MembershipPair: bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"}, BungieName: "Public#0001", Characters: []string{"10"}},
+			{MembershipPair: bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "2"}, BungieName: "Private#0002", Characters: []string{"20"}},
+		},
+	}
+
+	frames, err := Run(context.Background(), &client, dataQuery, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	if activities, _ := frame.Fields[0].ConcreteAt(0); activities != int64(1) {
+		t.Errorf("expected the public profile's activity to be counted, got %v", activities)
+	}
+
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || !strings.HasPrefix(frame.Meta.Notices[0].Text, "Private#0002") {
+		t.Errorf("expected a notice for the private profile, got %+v", frame.Meta)
+	}
+}
+
+func TestAggregateStatsReportsProfileErrorsPerProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/LinkedProfiles/"):
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "profiles": [] } }`))
+		case strings.Contains(r.URL.Path, "/Account/2/"):
+			w.Write([]byte(`{ "ErrorCode": 1665, "ErrorStatus": "DestinyPrivacyRestriction", "Message": "Private" }`))
+		case r.URL.Path == "/Platform/Destiny2/Manifest/":
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "version": "test", "jsonWorldComponentContentPaths": { "en": { "DestinyActivityModeDefinition": "/modes.json", "DestinyHistoricalStatsDefinition": "/stats.json" } } } }`))
+		case r.URL.Path == "/modes.json" || r.URL.Path == "/stats.json":
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{ "ErrorCode": 1, "ErrorStatus": "Success", "Response": { "allPvE": { "daily": [{ "period": "2024-01-01T00:00:00Z", "values": { "kills": { "basic": { "value": 3 } } } }] } } }`))
+		}
+	}))
+	defer server.Close()
+
+	client := bungieAPI.Create("test-key", bungieAPI.WithBaseURL(server.URL))
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dataQuery := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour * 24)}}
+	queryModel := QueryModel{
+		QueryType:  QueryTypeAggregateStats,
+		PeriodType: PeriodTypeDaily,
+		Profiles: []QueryProfile{
+			{MembershipPair: bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"}, BungieName: "Public#0001", Characters: []string{"10"}},
+			{MembershipPair: bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "2"}, BungieName: "Private#0002", Characters: []string{"20"}},
+		},
+	}
+
+	frames, err := Run(context.Background(), &client, dataQuery, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 1 || frames[0].Fields[1].Labels["character"] != "Public#0001" {
+		t.Fatalf("expected only the public profile's stats, got %v", frames)
+	}
+
+	frame := frames[0]
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || !strings.HasPrefix(frame.Meta.Notices[0].Text, "Private#0002") {
+		t.Errorf("expected a notice for the private profile, got %+v", frame.Meta)
+	}
+}
@@ -0,0 +1,194 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	PROGRESSIONS_COMPONENTS = []int{
+		bungie.DestinyComponentTypeProfiles,
+		bungie.DestinyComponentTypeProfileProgression,
+		bungie.DestinyComponentTypeCharacterProgressions,
+	}
+
+	// REPUTATION_PROGRESSIONS are the character progressions reported as reputation ranks, given fixed
+	// names rather than their localized definition names. Bungie sometimes replaces a reputation's
+	// progression in a new season, leaving it out of the results until its hash is updated here.
+	REPUTATION_PROGRESSIONS = []namedProgression{
+		{hash: 457612306, name: "Vanguard"},
+		{hash: 2083746873, name: "Crucible (Valor)"},
+		{hash: 1647151960, name: "Crucible (Glory)"},
+		{hash: 3008065600, name: "Gambit"},
+		{hash: 2755675426, name: "Trials"},
+	}
+)
+
+type namedProgression struct {
+	hash int
+	name string
+}
+
+// progressionRow is a single progression's rank, in the shape of the returned frame.
+type progressionRow struct {
+	name                string
+	level               int
+	progressToNextLevel int
+	nextLevelAt         int
+	resetCount          int
+}
+
+func init() {
+	RegisterQueryHandler(QueryTypeProgressions, QueryProgressions)
+}
+
+// seasonPassProgression combines the season pass's reward and prestige progressions into a single
+// rank. Once the reward track is capped, progress towards the next rank comes from the prestige track.
+func seasonPassProgression(characterProgression bungie.DestinyCharacterProgressionComponent, seasonPassDef *bungie.DestinySeasonPassDefinition) (progressionRow, bool) {
+	reward, ok := characterProgression.Progressions[seasonPassDef.RewardProgressionHash]
+	if !ok {
+		return progressionRow{}, false
+	}
+
+	row := progressionRow{
+		name:                "Season pass",
+		level:               reward.Level,
+		progressToNextLevel: reward.ProgressToNextLevel,
+		nextLevelAt:         reward.NextLevelAt,
+		resetCount:          reward.CurrentResetCount,
+	}
+
+	prestige, ok := characterProgression.Progressions[seasonPassDef.PrestigeProgressionHash]
+	if ok && reward.LevelCap > 0 && reward.Level >= reward.LevelCap {
+		row.level += prestige.Level
+		row.progressToNextLevel = prestige.ProgressToNextLevel
+		row.nextLevelAt = prestige.NextLevelAt
+	}
+
+	return row, true
+}
+
+// profileProgressions returns the profile's progressions, using the given character for character
+// scoped progressions. The season pass and Guardian Rank are left out of the rows when nil.
+func profileProgressions(progressions presentationProfile, seasonPassDef *bungie.DestinySeasonPassDefinition) []progressionRow {
+	rows := []progressionRow{}
+	characterProgression := progressions.profile.CharacterProgressions.Data[progressions.characterId]
+
+	if seasonPassDef != nil {
+		if row, ok := seasonPassProgression(characterProgression, seasonPassDef); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	artifact := progressions.profile.ProfileProgression.Data.SeasonalArtifact
+	if artifact.ArtifactHash != 0 {
+		rows = append(rows, progressionRow{
+			name:                "Artifact power bonus",
+			level:               artifact.PowerBonus,
+			progressToNextLevel: artifact.PowerBonusProgression.ProgressToNextLevel,
+			nextLevelAt:         artifact.PowerBonusProgression.NextLevelAt,
+			resetCount:          artifact.PowerBonusProgression.CurrentResetCount,
+		})
+	}
+
+	if guardianRank := progressions.guardianRank; guardianRank != nil && guardianRank.CurrentGuardianRank > 0 {
+		rows = append(rows, progressionRow{
+			name:  "Guardian Rank",
+			level: guardianRank.CurrentGuardianRank,
+		})
+	}
+
+	for _, reputation := range REPUTATION_PROGRESSIONS {
+		progression, ok := characterProgression.Progressions[reputation.hash]
+		if !ok {
+			continue
+		}
+
+		rows = append(rows, progressionRow{
+			name:                reputation.name,
+			level:               progression.Level,
+			progressToNextLevel: progression.ProgressToNextLevel,
+			nextLevelAt:         progression.NextLevelAt,
+			resetCount:          progression.CurrentResetCount,
+		})
+	}
+
+	return rows
+}
+
+// requestSeasonPassDefinition returns the season pass for the profile's current season, or nil
+// if the season doesn't have one.
+func requestSeasonPassDefinition(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, seasonHash int) (*bungie.DestinySeasonPassDefinition, error) {
+	seasonDef, err := bungieAPIClient.GetSeasonDefinitionForHash(ctx, seasonHash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get season definition: %w", err)
+	}
+	if seasonDef == nil || seasonDef.SeasonPassHash == 0 {
+		return nil, nil
+	}
+
+	seasonPassDef, err := bungieAPIClient.GetSeasonPassDefinitionForHash(ctx, seasonDef.SeasonPassHash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get season pass definition: %w", err)
+	}
+
+	return seasonPassDef, nil
+}
+
+// QueryProgressions returns the current rank of the season pass, artifact power bonus, Guardian Rank
+// and reputations for each profile, with a row per progression.
+func QueryProgressions(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	profiles, err := requestPresentationProfiles(ctx, bungieAPIClient, queryModel, PROGRESSIONS_COMPONENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	includePlayerColumn := len(queryModel.Profiles) > 1
+
+	playerField := data.NewField("Player", nil, []string{})
+	progressionField := data.NewField("Progression", nil, []string{})
+	levelField := data.NewField("Level", nil, []int64{})
+	progressField := data.NewField("Progress to next level", nil, []int64{})
+	nextLevelAtField := data.NewField("Next level at", nil, []int64{})
+	percentField := data.NewField("Percent to next level", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+	resetCountField := data.NewField("Reset count", nil, []int64{})
+
+	for _, progressions := range profiles {
+		seasonPassDef, err := requestSeasonPassDefinition(ctx, bungieAPIClient, progressions.profile.Profile.Data.CurrentSeasonHash)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range profileProgressions(progressions, seasonPassDef) {
+			playerField.Append(progressions.player)
+			progressionField.Append(row.name)
+			levelField.Append(int64(row.level))
+			progressField.Append(int64(row.progressToNextLevel))
+			nextLevelAtField.Append(int64(row.nextLevelAt))
+			percentField.Append(progressRatio(int64(row.progressToNextLevel), int64(row.nextLevelAt)))
+			resetCountField.Append(int64(row.resetCount))
+		}
+	}
+
+	frame := data.NewFrame("response")
+	if includePlayerColumn {
+		frame.Fields = append(frame.Fields, playerField)
+	}
+	frame.Fields = append(frame.Fields,
+		progressionField,
+		levelField,
+		progressField,
+		nextLevelAtField,
+		percentField,
+		resetCountField,
+	)
+	addProfileNotices(frame, queryModel.profileErrors)
+
+	return data.Frames{frame}, nil
+}
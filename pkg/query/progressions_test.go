@@ -0,0 +1,65 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"testing"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestSeasonPassProgressionAddsPrestigeRanks(t *testing.T) {
+	seasonPassDef := &bungie.DestinySeasonPassDefinition{RewardProgressionHash: 1, PrestigeProgressionHash: 2}
+	characterProgression := bungie.DestinyCharacterProgressionComponent{
+		Progressions: map[int]bungie.DestinyProgression{
+			1: {Level: 100, LevelCap: 100, CurrentResetCount: 1},
+			2: {Level: 12, ProgressToNextLevel: 50000, NextLevelAt: 100000},
+		},
+	}
+
+	row, ok := seasonPassProgression(characterProgression, seasonPassDef)
+	if !ok {
+		t.Fatal("expected a season pass progression")
+	}
+
+	if row.level != 112 || row.progressToNextLevel != 50000 || row.nextLevelAt != 100000 || row.resetCount != 1 {
+		t.Errorf("expected rank 112 with prestige progress, got %+v", row)
+	}
+}
+
+func TestProgressionsGuardianRankFromProfile(t *testing.T) {
+	// The fake API fails the test on any request other than these, so Guardian Rank must come from
+	// the same profile response as the other progressions
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/1/": `{
+			"profile": { "data": { "characterIds": [10], "currentGuardianRank": 7 } },
+			"characterProgressions": { "data": { "10": { "progressions": { "457612306": { "level": 16 } } } } }
+		}`,
+	}, map[string]string{"DestinySeasonDefinition": "{}"})
+
+	queryModel := QueryModel{
+		QueryType: QueryTypeProgressions,
+		Profile:   bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+	}
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	if frame.Rows() != 2 {
+		t.Fatalf("expected Guardian Rank and Vanguard rows, got %v", frame.Rows())
+	}
+
+	if row := frame.RowCopy(0); row[0] != "Guardian Rank" || row[1] != int64(7) {
+		t.Errorf("unexpected Guardian Rank row %v", row)
+	}
+
+	if row := frame.RowCopy(1); row[0] != "Vanguard" || row[1] != int64(16) {
+		t.Errorf("unexpected Vanguard row %v", row)
+	}
+}
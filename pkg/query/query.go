@@ -1,51 +1,159 @@
 package query
 
 import (
+	"context"
 	"fmt"
 	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
 	"sort"
+	"strconv"
 	"time"
 
 	bungie "github.com/joshhunt/bungieapigo/pkg/models"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
-	"golang.org/x/exp/slices"
 )
 
 type QueryModel struct {
+	QueryType    string                   `json:"queryType"`
 	Characters   []string                 `json:"characters"`
 	Profile      bungieAPI.MembershipPair `json:"profile"`
 	ActivityMode int                      `json:"activityMode"`
+	InstanceIds  []string                 `json:"instanceIds"`
+	Language     string                   `json:"language"`
+	BucketSize   string                   `json:"bucketSize"`
+	SplitBy      string                   `json:"splitBy"`
+	Reduce       string                   `json:"reduce"`
+	// Stat keys from each activity's values to add as columns, or ["all"]
+	Stats        []string `json:"stats"`
+	PeriodType   string   `json:"periodType"`
+	Modes        []int    `json:"modes"`
+	WeaponSource string   `json:"weaponSource"`
+
+	AllLinkedMemberships bool           `json:"allLinkedMemberships"`
+	Profiles             []QueryProfile `json:"profiles"`
+	ClanId               string         `json:"clanId"`
+	IncludeActivities    bool           `json:"includeActivities"`
+
+	PresentationNodeHash int `json:"presentationNodeHash"`
+
+	SnapshotSeries []string `json:"snapshotSeries"`
+	MetricHashes   []int    `json:"metricHashes"`
+
+	resolvedCharacters []queryCharacter
+	profileErrors      *profileErrors
 }
 
-func QueryActivityHistory(bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (*data.Frame, error) {
+// RequiresProfile reports whether the query can only run against a specific profile.
+func (queryModel QueryModel) RequiresProfile() bool {
+	if queryModel.QueryType == QueryTypePostGameCarnageReport {
+		return len(queryModel.InstanceIds) == 0
+	}
+
+	if queryModel.QueryType == QueryTypeClanRoster {
+		return false
+	}
+
+	return true
+}
+
+func init() {
+	RegisterQueryHandler(QueryTypeActivityHistory, func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+		frame, err := QueryActivityHistory(ctx, bungieAPIClient, dataQuery, queryModel)
+		if err != nil {
+			return nil, err
+		}
+
+		return data.Frames{frame}, nil
+	})
+}
+
+var (
+	// Display text for the standing values in activity history, indexed by Bungie's standing value
+	STANDINGS = []string{"Victory", "Defeat"}
+
+	// The most characters to fetch activity history for at once within a single query
+	MAX_CONCURRENT_CHARACTERS = 3
+	// The most profiles to resolve at once within a multi-profile or clan query
+	MAX_CONCURRENT_PROFILES = 5
+	// The most PGCRs to fetch at once within a single query
+	MAX_CONCURRENT_PGCRS = 5
+	// The most PGCRs weapon usage totals over a time range, as each of them is a separate request
+	MAX_WEAPON_USAGE_PGCRS = 250
+)
+
+// requestActivityHistoryByCharacter fetches the activity history within timeRange for each of the query's
+// characters in parallel, returned in the same order as queryModel.characters().
+func requestActivityHistoryByCharacter(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, queryModel QueryModel, timeRange backend.TimeRange) ([][]bungie.DestinyHistoricalStatsPeriodGroup, error) {
+	characters := queryModel.characters()
+	activityHistoryByCharacter := make([][]bungie.DestinyHistoricalStatsPeriodGroup, len(characters))
+
+	err := runConcurrently(ctx, len(characters), MAX_CONCURRENT_CHARACTERS, func(ctx context.Context, i int) error {
+		character := characters[i]
+		activityHistory, err := bungieAPIClient.RequestCharacterActivityHistoryForRange(ctx, character.membership.MembershipType, character.membership.MembershipId, character.characterId, queryModel.ActivityMode, timeRange)
+		if err != nil && queryModel.profileErrors != nil {
+			// Leave out the player's activities rather than failing every profile of the query
+			queryModel.profileErrors.add(character.player, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		activityHistoryByCharacter[i] = activityHistory
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get activity history: %w", err)
+	}
+
+	return activityHistoryByCharacter, nil
+}
+
+// standingEnumIndex returns the index of the standing's text, adding the raw value to the texts
+// for standings other than those in STANDINGS.
+func standingEnumIndex(standingTexts *[]string, value float64) data.EnumItemIndex {
+	if value >= 0 && int(value) < len(STANDINGS) && value == float64(int(value)) {
+		return data.EnumItemIndex(value)
+	}
+
+	text := strconv.FormatFloat(value, 'f', -1, 64)
+	for i, existingText := range *standingTexts {
+		if existingText == text {
+			return data.EnumItemIndex(i)
+		}
+	}
+
+	*standingTexts = append(*standingTexts, text)
+	return data.EnumItemIndex(len(*standingTexts) - 1)
+}
+
+func QueryActivityHistory(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (*data.Frame, error) {
 	allActivityHistory := []bungie.DestinyHistoricalStatsPeriodGroup{}
-	includeCharacterColumn := len(queryModel.Characters) > 1
-	characterDescriptions := []bungieAPI.ListCharactersResourceResponseItem{}
+	characters := queryModel.characters()
+	includeCharacterColumn := len(characters) > 1
+	includePlayerColumn := len(queryModel.Profiles) > 1
+	characterNames := map[string]string{}
 
 	var err error
 
 	if includeCharacterColumn {
-		characterDescriptions, err = bungieAPIClient.RequestCharacterDescriptions(queryModel.Profile.MembershipType, queryModel.Profile.MembershipId)
+		characterNames, err = requestCharacterNames(ctx, bungieAPIClient, characters, queryModel.profileErrors)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get characters: %v", err.Error())
+			return nil, err
 		}
 
-		includeCharacterColumn = len(characterDescriptions) > 1
+		includeCharacterColumn = len(characterNames) > 1
 	}
 
-	for _, characterId := range queryModel.Characters {
-		activityHistory, err := bungieAPIClient.RequestCharacterActivityHistoryForRange(queryModel.Profile.MembershipType, queryModel.Profile.MembershipId, characterId, queryModel.ActivityMode, dataQuery.TimeRange)
-		if err != nil {
-			return nil, fmt.Errorf("unable to get activity history: %v", err.Error())
-		}
+	activityHistoryByCharacter, err := requestActivityHistoryByCharacter(ctx, bungieAPIClient, queryModel, dataQuery.TimeRange)
+	if err != nil {
+		return nil, err
+	}
 
-		characterDescriptionIndex := slices.IndexFunc(characterDescriptions, func(v bungieAPI.ListCharactersResourceResponseItem) bool { return v.CharacterId == characterId })
-		var characterDescription string
-		if characterDescriptionIndex > -1 {
-			characterDescription = characterDescriptions[characterDescriptionIndex].Description
-		}
+	for i, character := range characters {
+		activityHistory := activityHistoryByCharacter[i]
+		characterDescription := characterNames[character.characterId]
 
 		if includeCharacterColumn {
 			for _, activity := range activityHistory {
@@ -57,6 +165,16 @@ func QueryActivityHistory(bungieAPIClient *bungieAPI.BungieAPI, dataQuery backen
 			}
 		}
 
+		if includePlayerColumn {
+			for _, activity := range activityHistory {
+				activity.Values["$player"] = bungie.DestinyHistoricalStatsValue{
+					Basic: bungie.DestinyHistoricalStatsValuePair{
+						DisplayValue: character.player,
+					},
+				}
+			}
+		}
+
 		allActivityHistory = append(allActivityHistory, activityHistory...)
 	}
 
@@ -64,22 +182,34 @@ func QueryActivityHistory(bungieAPIClient *bungieAPI.BungieAPI, dataQuery backen
 		return allActivityHistory[i].Period.After(allActivityHistory[j].Period)
 	})
 
+	if queryModel.Reduce != ReduceNone {
+		frame, err := reduceActivityHistory(allActivityHistory, queryModel.Reduce, dataQuery.TimeRange)
+		if err != nil {
+			return nil, err
+		}
+
+		addProfileNotices(frame, queryModel.profileErrors)
+		return frame, nil
+	}
+
 	timeField := data.NewField("Time", nil, []time.Time{})
 	instanceIDField := data.NewField("PGCR ID", nil, []int64{})
 
 	endTimeField := data.NewField("End time", nil, []time.Time{})
-	durationField := data.NewField("Activity duration", nil, []int64{})
-	timePlayedField := data.NewField("Time played", nil, []string{})
+	durationField := data.NewField("Activity duration", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "s"})
+	timePlayedField := data.NewField("Time played", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "s"})
 
 	activityModeNameField := data.NewField("Activity mode", nil, []string{})
 	activityNameField := data.NewField("Activity", nil, []string{})
 	directorActivityNameField := data.NewField("Director activity", nil, []string{})
 
-	standingField := data.NewField("Standing", nil, []string{})
-	completedField := data.NewField("Completed", nil, []string{})
+	standingTexts := append([]string{}, STANDINGS...)
+	standingField := data.NewField("Standing", nil, []*data.EnumItemIndex{})
+	completedField := data.NewField("Completed", nil, []bool{})
 	completionReasonField := data.NewField("Completion reason", nil, []string{})
 
 	characterField := data.NewField("Character", nil, []string{})
+	playerField := data.NewField("Player", nil, []string{})
 
 	includeStanding := false
 
@@ -92,26 +222,37 @@ func QueryActivityHistory(bungieAPIClient *bungieAPI.BungieAPI, dataQuery backen
 		timeField.Append(activity.Period)
 		instanceIDField.Append(activity.ActivityDetails.InstanceId)
 
-		activityModeDef := bungieAPIClient.GetActivityModeDefinitionForModeType(int(activity.ActivityDetails.Mode))
-		activityModeNameField.Append(activityModeDef.DisplayProperties.Name)
-
-		activityDef := bungieAPIClient.GetActivityDefinitionForHash(activity.ActivityDetails.ReferenceId)
-		activityNameField.Append(activityDef.DisplayProperties.Name)
-
-		directorActivityDef := bungieAPIClient.GetActivityDefinitionForHash(activity.ActivityDetails.DirectorActivityHash)
-		directorActivityNameField.Append(directorActivityDef.DisplayProperties.Name)
+		modeName, err := activityModeName(ctx, bungieAPIClient, int(activity.ActivityDetails.Mode))
+		if err != nil {
+			return nil, err
+		}
+		activityModeNameField.Append(modeName)
 
-		standing := activity.Values["standing"].Basic.DisplayValue
-		standingField.Append(standing)
+		name, err := activityName(ctx, bungieAPIClient, activity.ActivityDetails.ReferenceId)
+		if err != nil {
+			return nil, err
+		}
+		activityNameField.Append(name)
 
-		timePlayed := activity.Values["timePlayedSeconds"].Basic.DisplayValue
-		timePlayedField.Append(timePlayed)
+		directorActivityName, err := activityName(ctx, bungieAPIClient, activity.ActivityDetails.DirectorActivityHash)
+		if err != nil {
+			return nil, err
+		}
+		directorActivityNameField.Append(directorActivityName)
 
-		if standing != "" {
+		// Only competitive activities have a standing
+		if standing, ok := activity.Values["standing"]; ok {
+			standingIndex := standingEnumIndex(&standingTexts, standing.Basic.Value)
+			standingField.Append(&standingIndex)
 			includeStanding = true
+		} else {
+			standingField.Append(nil)
 		}
 
-		completed := activity.Values["completed"].Basic.DisplayValue
+		timePlayed := activity.Values["timePlayedSeconds"].Basic.Value
+		timePlayedField.Append(int64(timePlayed))
+
+		completed := activity.Values["completed"].Basic.Value == 1
 		completedField.Append(completed)
 
 		completionReason := activity.Values["completionReason"].Basic.DisplayValue
@@ -120,6 +261,10 @@ func QueryActivityHistory(bungieAPIClient *bungieAPI.BungieAPI, dataQuery backen
 		if includeCharacterColumn {
 			characterField.Append(activity.Values["$character"].Basic.DisplayValue)
 		}
+
+		if includePlayerColumn {
+			playerField.Append(activity.Values["$player"].Basic.DisplayValue)
+		}
 	}
 
 	// https://grafana.com/docs/grafana/latest/developers/plugins/data-frames/
@@ -137,12 +282,27 @@ func QueryActivityHistory(bungieAPIClient *bungieAPI.BungieAPI, dataQuery backen
 	)
 
 	if includeStanding {
+		standingField.SetConfig(&data.FieldConfig{
+			TypeConfig: &data.FieldTypeConfig{Enum: &data.EnumFieldConfig{Text: standingTexts}},
+		})
 		frame.Fields = append(frame.Fields, standingField)
 	}
 
+	if includePlayerColumn {
+		frame.Fields = append(frame.Fields, playerField)
+	}
+
 	if includeCharacterColumn {
 		frame.Fields = append(frame.Fields, characterField)
 	}
 
+	statFields, err := statFields(ctx, bungieAPIClient, queryModel.Stats, allActivityHistory)
+	if err != nil {
+		return nil, err
+	}
+	frame.Fields = append(frame.Fields, statFields...)
+
+	addProfileNotices(frame, queryModel.profileErrors)
+
 	return frame, nil
 }
@@ -0,0 +1,42 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestStandingEnumIndex(t *testing.T) {
+	standingTexts := append([]string{}, STANDINGS...)
+
+	tests := []struct {
+		value    float64
+		expected data.EnumItemIndex
+	}{
+		{0, 0},
+		{1, 1},
+		{2, 2},
+		{-1, 3},
+		{2, 2},
+	}
+
+	for _, test := range tests {
+		if index := standingEnumIndex(&standingTexts, test.value); index != test.expected {
+			t.Errorf("expected standing %v to have index %v, got %v", test.value, test.expected, index)
+		}
+	}
+
+	expectedTexts := []string{"Victory", "Defeat", "2", "-1"}
+	if len(standingTexts) != len(expectedTexts) {
+		t.Fatalf("unexpected standing texts %v", standingTexts)
+	}
+	for i := range expectedTexts {
+		if standingTexts[i] != expectedTexts[i] {
+			t.Errorf("unexpected standing texts %v", standingTexts)
+		}
+	}
+
+	if len(STANDINGS) != 2 {
+		t.Errorf("STANDINGS must not be modified, got %v", STANDINGS)
+	}
+}
@@ -0,0 +1,223 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"joshhunt-destiny-datasource/pkg/snapshots"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+const (
+	SnapshotLight        = "light"
+	SnapshotTriumphScore = "triumphScore"
+	SnapshotProgressions = "progressions"
+)
+
+var (
+	DEFAULT_SNAPSHOT_INTERVAL = time.Hour
+	MIN_SNAPSHOT_INTERVAL     = time.Minute * 15
+)
+
+// snapshotRecorder records one kind of snapshot from a profile requested with its components.
+type snapshotRecorder struct {
+	components []int
+	record     func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, profile presentationProfile, values map[string]float64) error
+}
+
+var snapshotRecorders = map[string]snapshotRecorder{
+	SnapshotLight: {
+		components: []int{bungie.DestinyComponentTypeProfiles, bungie.DestinyComponentTypeCharacters},
+		record: func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, profile presentationProfile, values map[string]float64) error {
+			characterIds := profile.profile.Profile.Data.CharacterIds
+			classCounts := map[bungie.DestinyClass]int{}
+			for _, characterId := range characterIds {
+				classCounts[profile.profile.Characters.Data[characterId].ClassType]++
+			}
+
+			// Characters are named by their class, and their ID too when the profile has more than one of the class
+			for _, characterId := range characterIds {
+				character, ok := profile.profile.Characters.Data[characterId]
+				if !ok {
+					continue
+				}
+
+				className := bungieAPIClient.GetClassTypeName(character.ClassType)
+				seriesName := fmt.Sprintf("Light (%v)", className)
+				if classCounts[character.ClassType] > 1 {
+					seriesName = fmt.Sprintf("Light (%v %v)", className, characterId)
+				}
+
+				values[seriesName] = float64(character.Light)
+			}
+
+			return nil
+		},
+	},
+	SnapshotTriumphScore: {
+		components: []int{bungie.DestinyComponentTypeProfiles, bungie.DestinyComponentTypeRecords},
+		record: func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, profile presentationProfile, values map[string]float64) error {
+			records := profile.profile.ProfileRecords.Data
+			values["Active triumph score"] = float64(records.ActiveScore)
+			values["Legacy triumph score"] = float64(records.LegacyScore)
+			values["Lifetime triumph score"] = float64(records.LifetimeScore)
+
+			return nil
+		},
+	},
+	SnapshotProgressions: {
+		components: PROGRESSIONS_COMPONENTS,
+		record: func(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, profile presentationProfile, values map[string]float64) error {
+			seasonPassDef, err := requestSeasonPassDefinition(ctx, bungieAPIClient, profile.profile.Profile.Data.CurrentSeasonHash)
+			if err != nil {
+				return err
+			}
+
+			for _, row := range profileProgressions(profile, seasonPassDef) {
+				values[row.name] = float64(row.level)
+				values[row.name+" reset count"] = float64(row.resetCount)
+			}
+
+			return nil
+		},
+	},
+}
+
+// IsSupportedSnapshot reports whether the recorder knows how to record the kind of snapshot.
+func IsSupportedSnapshot(snapshot string) bool {
+	_, ok := snapshotRecorders[snapshot]
+	return ok
+}
+
+// RecorderOptions configures which profiles the Recorder snapshots, what it records and how often.
+type RecorderOptions struct {
+	Profiles []bungieAPI.MembershipPair
+	// Snapshot kinds to record, or all of them when empty
+	Snapshots []string
+	Interval  time.Duration
+}
+
+// Recorder periodically snapshots profiles into a store, so values Bungie only reports the current
+// state of can be graphed over time.
+type Recorder struct {
+	bungieAPIClient *bungieAPI.BungieAPI
+	store           *snapshots.Store
+	options         RecorderOptions
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func NewRecorder(bungieAPIClient *bungieAPI.BungieAPI, store *snapshots.Store, options RecorderOptions) *Recorder {
+	if options.Interval == 0 {
+		options.Interval = DEFAULT_SNAPSHOT_INTERVAL
+	}
+	if options.Interval < MIN_SNAPSHOT_INTERVAL {
+		options.Interval = MIN_SNAPSHOT_INTERVAL
+	}
+
+	if len(options.Snapshots) == 0 {
+		for snapshot := range snapshotRecorders {
+			options.Snapshots = append(options.Snapshots, snapshot)
+		}
+		sort.Strings(options.Snapshots)
+	}
+
+	return &Recorder{
+		bungieAPIClient: bungieAPIClient,
+		store:           store,
+		options:         options,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+}
+
+// Start records a snapshot of every profile straight away, and then once every interval until stopped.
+func (recorder *Recorder) Start() {
+	go func() {
+		defer close(recorder.done)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-recorder.stop
+			cancel()
+		}()
+
+		ticker := time.NewTicker(recorder.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			recorder.RecordAll(ctx)
+
+			select {
+			case <-ticker.C:
+			case <-recorder.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop cancels any snapshot in progress and waits for the recorder to finish.
+func (recorder *Recorder) Stop() {
+	recorder.stopOnce.Do(func() {
+		close(recorder.stop)
+	})
+	<-recorder.done
+}
+
+// RecordAll records a snapshot of every profile. Failures are logged rather than returned, so
+// one private or missing profile doesn't stop the others being recorded.
+func (recorder *Recorder) RecordAll(ctx context.Context) {
+	for _, membership := range recorder.options.Profiles {
+		err := recorder.Record(ctx, membership)
+		if err != nil && ctx.Err() == nil {
+			backend.Logger.Warn("Unable to record profile snapshot", "error", err, "membershipType", membership.MembershipType, "membershipId", membership.MembershipId)
+		}
+	}
+}
+
+// Record requests the profile's components and appends a snapshot of them to the store. Snapshots
+// are stored against the profile's cross save primary membership, which is the membership player
+// search returns for cross save players, so snapshots queries can read them without resolving it.
+func (recorder *Recorder) Record(ctx context.Context, membership bungieAPI.MembershipPair) error {
+	primaryMembership := recorder.bungieAPIClient.ResolvePrimaryMembership(ctx, membership)
+
+	components := []int{}
+	seenComponents := map[int]bool{}
+	for _, snapshot := range recorder.options.Snapshots {
+		for _, component := range snapshotRecorders[snapshot].components {
+			if !seenComponents[component] {
+				seenComponents[component] = true
+				components = append(components, component)
+			}
+		}
+	}
+
+	profile, guardianRank, err := recorder.bungieAPIClient.RequestProfileWithGuardianRank(ctx, primaryMembership.MembershipType, primaryMembership.MembershipId, components)
+	if err != nil {
+		return fmt.Errorf("unable to get profile: %w", err)
+	}
+
+	snapshotProfile := presentationProfile{membership: primaryMembership, profile: profile, guardianRank: guardianRank}
+	if len(profile.Profile.Data.CharacterIds) > 0 {
+		snapshotProfile.characterId = profile.Profile.Data.CharacterIds[0]
+	}
+
+	snapshot := snapshots.Snapshot{Time: time.Now().UTC(), Values: map[string]float64{}}
+	for _, kind := range recorder.options.Snapshots {
+		err := snapshotRecorders[kind].record(ctx, recorder.bungieAPIClient, snapshotProfile, snapshot.Values)
+		if err != nil {
+			return fmt.Errorf("unable to record %v snapshot: %w", kind, err)
+		}
+	}
+
+	return recorder.store.Append(primaryMembership, snapshot)
+}
@@ -0,0 +1,55 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"joshhunt-destiny-datasource/pkg/snapshots"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestRecordLightPerCharacter(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Profile/1/": `{
+			"profile": { "data": { "characterIds": [10, 11, 12] } },
+			"characters": { "data": {
+				"10": { "characterId": "10", "classType": 1, "light": 1800 },
+				"11": { "characterId": "11", "classType": 1, "light": 1810 },
+				"12": { "characterId": "12", "classType": 2, "light": 1790 }
+			} }
+		}`,
+	}, nil)
+
+	store := snapshots.NewStore(t.TempDir(), 0)
+	membership := bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"}
+	recorder := NewRecorder(client, store, RecorderOptions{Snapshots: []string{SnapshotLight}})
+
+	err := recorder.Record(context.Background(), membership)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	recorded, err := store.Read(membership, backend.TimeRange{From: now.Add(-time.Hour), To: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 1 {
+		t.Fatalf("expected a single snapshot, got %+v", recorded)
+	}
+
+	// Characters sharing a class each get their own series
+	expected := map[string]float64{"Light (Hunter 10)": 1800, "Light (Hunter 11)": 1810, "Light (Warlock)": 1790}
+	values := recorded[0].Values
+	if len(values) != len(expected) {
+		t.Errorf("expected %v series, got %v", len(expected), values)
+	}
+	for seriesName, light := range expected {
+		if values[seriesName] != light {
+			t.Errorf("expected %v to be %v, got %v", seriesName, light, values)
+		}
+	}
+}
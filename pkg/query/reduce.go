@@ -0,0 +1,132 @@
+package query
+
+import (
+	"fmt"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	ReduceNone = ""
+	// Only the most recent activity
+	ReduceLatest = "latest"
+	// Totals across every activity in the time range
+	ReduceTotal = "total"
+)
+
+func killDeathRatio(kills float64, deaths float64) float64 {
+	if deaths == 0 {
+		return kills
+	}
+
+	return kills / deaths
+}
+
+// reduceActivityHistory collapses activity history, sorted newest first, into a single row of
+// numeric fields so the result can be evaluated by alert rules.
+func reduceActivityHistory(activityHistory []bungie.DestinyHistoricalStatsPeriodGroup, reduce string, timeRange backend.TimeRange) (*data.Frame, error) {
+	switch reduce {
+	case ReduceLatest:
+		return reduceLatestActivity(activityHistory), nil
+	case ReduceTotal:
+		return reduceTotalActivity(activityHistory, timeRange), nil
+	default:
+		return nil, fmt.Errorf("unknown reduce mode %q", reduce)
+	}
+}
+
+func reduceLatestActivity(activityHistory []bungie.DestinyHistoricalStatsPeriodGroup) *data.Frame {
+	timeField := data.NewField("Time", nil, []time.Time{})
+	completedField := data.NewField("Completed", nil, []int64{})
+	durationField := data.NewField("Activity duration", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "s"})
+	timePlayedField := data.NewField("Time played", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "s"})
+	killsField := data.NewField("Kills", nil, []int64{})
+	deathsField := data.NewField("Deaths", nil, []int64{})
+	assistsField := data.NewField("Assists", nil, []int64{})
+	killDeathRatioField := data.NewField("K/D", nil, []float64{})
+
+	if len(activityHistory) > 0 {
+		activity := activityHistory[0]
+		kills := activity.Values["kills"].Basic.Value
+		deaths := activity.Values["deaths"].Basic.Value
+
+		timeField.Append(activity.Period)
+		completedField.Append(int64(activity.Values["completed"].Basic.Value))
+		durationField.Append(int64(activity.Values["activityDurationSeconds"].Basic.Value))
+		timePlayedField.Append(int64(activity.Values["timePlayedSeconds"].Basic.Value))
+		killsField.Append(int64(kills))
+		deathsField.Append(int64(deaths))
+		assistsField.Append(int64(activity.Values["assists"].Basic.Value))
+		killDeathRatioField.Append(killDeathRatio(kills, deaths))
+	}
+
+	frame := data.NewFrame("response",
+		timeField,
+		completedField,
+		durationField,
+		timePlayedField,
+		killsField,
+		deathsField,
+		assistsField,
+		killDeathRatioField,
+	)
+	frame.SetMeta(&data.FrameMeta{Type: data.FrameTypeTimeSeriesWide})
+
+	return frame
+}
+
+func reduceTotalActivity(activityHistory []bungie.DestinyHistoricalStatsPeriodGroup, timeRange backend.TimeRange) *data.Frame {
+	var completions, secondsPlayed, kills, deaths, assists float64
+	var lastActivity, lastCompletion *time.Time
+
+	for i := range activityHistory {
+		activity := activityHistory[i]
+
+		completed := activity.Values["completed"].Basic.Value == 1
+		if completed {
+			completions += 1
+		}
+
+		secondsPlayed += activity.Values["timePlayedSeconds"].Basic.Value
+		kills += activity.Values["kills"].Basic.Value
+		deaths += activity.Values["deaths"].Basic.Value
+		assists += activity.Values["assists"].Basic.Value
+
+		// Activity history is sorted newest first
+		activityEnd := activity.Period.Add(time.Second * time.Duration(activity.Values["activityDurationSeconds"].Basic.Value))
+		if lastActivity == nil {
+			lastActivity = &activityEnd
+		}
+		if completed && lastCompletion == nil {
+			lastCompletion = &activityEnd
+		}
+	}
+
+	secondsSince := func(t *time.Time) *int64 {
+		if t == nil {
+			return nil
+		}
+
+		seconds := int64(timeRange.To.Sub(*t).Seconds())
+		return &seconds
+	}
+
+	frame := data.NewFrame("response",
+		data.NewField("Activities", nil, []int64{int64(len(activityHistory))}),
+		data.NewField("Completions", nil, []int64{int64(completions)}),
+		data.NewField("Time played", nil, []int64{int64(secondsPlayed)}).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("Kills", nil, []int64{int64(kills)}),
+		data.NewField("Deaths", nil, []int64{int64(deaths)}),
+		data.NewField("Assists", nil, []int64{int64(assists)}),
+		data.NewField("K/D", nil, []float64{killDeathRatio(kills, deaths)}),
+		data.NewField("Time since last activity", nil, []*int64{secondsSince(lastActivity)}).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("Time since last completion", nil, []*int64{secondsSince(lastCompletion)}).SetConfig(&data.FieldConfig{Unit: "s"}),
+	)
+	frame.SetMeta(&data.FrameMeta{Type: data.FrameTypeNumericWide})
+
+	return frame
+}
@@ -0,0 +1,56 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func testActivity(period time.Time, completed float64, kills float64, deaths float64) bungie.DestinyHistoricalStatsPeriodGroup {
+	return bungie.DestinyHistoricalStatsPeriodGroup{
+		Period: period,
+		Values: map[string]bungie.DestinyHistoricalStatsValue{
+			"completed":               {Basic: bungie.DestinyHistoricalStatsValuePair{Value: completed}},
+			"kills":                   {Basic: bungie.DestinyHistoricalStatsValuePair{Value: kills}},
+			"deaths":                  {Basic: bungie.DestinyHistoricalStatsValuePair{Value: deaths}},
+			"activityDurationSeconds": {Basic: bungie.DestinyHistoricalStatsValuePair{Value: 600}},
+		},
+	}
+}
+
+func TestReduceTotalActivity(t *testing.T) {
+	now := time.Now()
+	timeRange := backend.TimeRange{From: now.Add(-time.Hour * 24 * 7), To: now}
+
+	activityHistory := []bungie.DestinyHistoricalStatsPeriodGroup{
+		testActivity(now.Add(-time.Hour), 0, 10, 20),
+		testActivity(now.Add(-time.Hour*2), 1, 5, 10),
+	}
+
+	frame, err := reduceActivityHistory(activityHistory, ReduceTotal, timeRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, _ := frame.RowLen(); rows != 1 {
+		t.Fatalf("expected a single row, got %v", rows)
+	}
+
+	field, _ := frame.FieldByName("K/D")
+	if kd := field.At(0).(float64); kd != 0.5 {
+		t.Errorf("expected K/D of 0.5, got %v", kd)
+	}
+
+	field, _ = frame.FieldByName("Completions")
+	if completions := field.At(0).(int64); completions != 1 {
+		t.Errorf("expected 1 completion, got %v", completions)
+	}
+
+	field, _ = frame.FieldByName("Time since last completion")
+	if seconds := *field.At(0).(*int64); seconds != int64((time.Hour*2 - time.Minute*10).Seconds()) {
+		t.Errorf("unexpected time since last completion %v", seconds)
+	}
+}
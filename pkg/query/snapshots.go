@@ -0,0 +1,105 @@
+package query
+
+import (
+	"fmt"
+	"joshhunt-destiny-datasource/pkg/snapshots"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// snapshotSeries is one recorded value of a profile over time.
+type snapshotSeries struct {
+	times  []time.Time
+	values []float64
+}
+
+// snapshotAccounts returns the query's profiles as the memberships their snapshots are stored
+// against, without resolving them through the Bungie API.
+func snapshotAccounts(queryModel QueryModel) []queryCharacter {
+	if len(queryModel.Profiles) == 0 {
+		return []queryCharacter{{membership: queryModel.Profile, characterId: "0"}}
+	}
+
+	accounts := make([]queryCharacter, 0, len(queryModel.Profiles))
+	for _, profile := range queryModel.Profiles {
+		accounts = append(accounts, queryCharacter{membership: profile.MembershipPair, characterId: "0", player: profile.BungieName})
+	}
+
+	return accounts
+}
+
+// QuerySnapshots returns the values the recorder snapshotted for each profile within the time range,
+// as a frame per recorded series. The query's series filter the results by name, when given.
+//
+// Snapshots are read from the data source's own store rather than the Bungie API, so the data source
+// runs this directly instead of through Run, and snapshots already recorded can still be graphed
+// while Bungie is unavailable.
+func QuerySnapshots(snapshotStore *snapshots.Store, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	selectedSeries := map[string]bool{}
+	for _, seriesName := range queryModel.SnapshotSeries {
+		selectedSeries[seriesName] = true
+	}
+
+	includePlayerLabel := len(queryModel.Profiles) > 1
+	frames := data.Frames{}
+
+	for _, account := range snapshotAccounts(queryModel) {
+		accountSnapshots, err := snapshotStore.Read(account.membership, dataQuery.TimeRange)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read snapshots: %w", err)
+		}
+
+		seriesByName := map[string]*snapshotSeries{}
+		for _, snapshot := range accountSnapshots {
+			for seriesName, value := range snapshot.Values {
+				if len(selectedSeries) > 0 && !selectedSeries[seriesName] {
+					continue
+				}
+
+				series, ok := seriesByName[seriesName]
+				if !ok {
+					series = &snapshotSeries{times: []time.Time{}, values: []float64{}}
+					seriesByName[seriesName] = series
+				}
+
+				series.times = append(series.times, snapshot.Time)
+				series.values = append(series.values, value)
+			}
+		}
+
+		seriesNames := make([]string, 0, len(seriesByName))
+		for seriesName := range seriesByName {
+			seriesNames = append(seriesNames, seriesName)
+		}
+		sort.Strings(seriesNames)
+
+		for _, seriesName := range seriesNames {
+			series := seriesByName[seriesName]
+
+			labels := data.Labels{"series": seriesName}
+			displayName := seriesName
+			if includePlayerLabel {
+				labels["player"] = account.player
+				displayName = fmt.Sprintf("%v: %v", account.player, seriesName)
+			}
+
+			frame := data.NewFrame("response",
+				data.NewField("Time", nil, series.times),
+				data.NewField("Value", labels, series.values).SetConfig(&data.FieldConfig{DisplayNameFromDS: displayName}),
+			)
+
+			frames = append(frames, frame)
+		}
+	}
+
+	if len(frames) == 0 {
+		frames = append(frames, data.NewFrame("response",
+			data.NewField("Time", nil, []time.Time{}),
+			data.NewField("Value", nil, []float64{}),
+		))
+	}
+	return frames, nil
+}
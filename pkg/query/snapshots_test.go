@@ -0,0 +1,50 @@
+package query
+
+import (
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"joshhunt-destiny-datasource/pkg/snapshots"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQuerySnapshotsReadsStoredMembershipsWithoutBungie(t *testing.T) {
+	store := snapshots.NewStore(t.TempDir(), 0)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	guardian := bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"}
+	friend := bungieAPI.MembershipPair{MembershipType: 2, MembershipId: "2"}
+	for _, membership := range []bungieAPI.MembershipPair{guardian, friend} {
+		err := store.Append(membership, snapshots.Snapshot{Time: now, Values: map[string]float64{"Light (Hunter)": 1800, "Guardian Rank": 6}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queryModel := QueryModel{
+		QueryType:      QueryTypeSnapshots,
+		SnapshotSeries: []string{"Guardian Rank"},
+		Profiles: []QueryProfile{
+			{MembershipPair: guardian, BungieName: "Guardian#0001"},
+			{MembershipPair: friend, BungieName: "Friend#0002"},
+		},
+	}
+	dataQuery := backend.DataQuery{TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now.Add(time.Hour)}}
+
+	frames, err := QuerySnapshots(store, dataQuery, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("expected a frame per player for the selected series, got %v", len(frames))
+	}
+
+	for i, player := range []string{"Guardian#0001", "Friend#0002"} {
+		field := frames[i].Fields[1]
+		if field.Labels["player"] != player || field.Labels["series"] != "Guardian Rank" || field.At(0).(float64) != 6 {
+			t.Errorf("expected %v's Guardian Rank, got %v %v", player, field.Labels, field.At(0))
+		}
+	}
+}
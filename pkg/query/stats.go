@@ -0,0 +1,146 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// Selects every stat the activities report, instead of a list of stat keys
+	StatsAll = "all"
+)
+
+var (
+	// Stats that activity history already has dedicated columns for, left out of the selected stats
+	statsWithColumns = map[string]bool{
+		"activityDurationSeconds": true,
+		"timePlayedSeconds":       true,
+		"completed":               true,
+		"completionReason":        true,
+		"standing":                true,
+		"$character":              true,
+		"$player":                 true,
+	}
+)
+
+// selectedStatKeys resolves the query's stat selection into the list of stat keys to add as columns.
+func selectedStatKeys(stats []string, activityHistory []bungie.DestinyHistoricalStatsPeriodGroup) []string {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	statKeys := []string{}
+
+	if len(stats) != 1 || stats[0] != StatsAll {
+		for _, statKey := range stats {
+			if seen[statKey] || statsWithColumns[statKey] {
+				continue
+			}
+
+			seen[statKey] = true
+			statKeys = append(statKeys, statKey)
+		}
+
+		return statKeys
+	}
+
+	for _, activity := range activityHistory {
+		for statKey := range activity.Values {
+			if seen[statKey] || statsWithColumns[statKey] {
+				continue
+			}
+
+			seen[statKey] = true
+			statKeys = append(statKeys, statKey)
+		}
+	}
+	sort.Strings(statKeys)
+
+	return statKeys
+}
+
+// newStatField creates a field typed and labelled according to the stat's definition. Values are
+// nullable because not every activity reports every stat.
+func newStatField(statKey string, statDef *bungie.DestinyHistoricalStatsDefinition, values []*float64) *data.Field {
+	name := statKey
+	var unitType bungie.UnitType
+	if statDef != nil {
+		if statDef.StatName != "" {
+			name = statDef.StatName
+		}
+		unitType = statDef.UnitType
+	}
+
+	switch unitType {
+	case bungie.UnitTypeBoolean:
+		boolValues := make([]*bool, len(values))
+		for i, value := range values {
+			if value != nil {
+				boolValue := *value == 1
+				boolValues[i] = &boolValue
+			}
+		}
+		return data.NewField(name, nil, boolValues)
+
+	case bungie.UnitTypeCount, bungie.UnitTypePoints, bungie.UnitTypeTeam, bungie.UnitTypeStanding, bungie.UnitTypeCompletionReason,
+		bungie.UnitTypeSeconds, bungie.UnitTypeMilliseconds:
+		intValues := make([]*int64, len(values))
+		for i, value := range values {
+			if value != nil {
+				intValue := int64(*value)
+				intValues[i] = &intValue
+			}
+		}
+
+		field := data.NewField(name, nil, intValues)
+		switch unitType {
+		case bungie.UnitTypeSeconds:
+			field.SetConfig(&data.FieldConfig{Unit: "s"})
+		case bungie.UnitTypeMilliseconds:
+			field.SetConfig(&data.FieldConfig{Unit: "ms"})
+		}
+		return field
+
+	case bungie.UnitTypePercent:
+		return data.NewField(name, nil, values).SetConfig(&data.FieldConfig{Unit: "percent"})
+
+	default:
+		return data.NewField(name, nil, values)
+	}
+}
+
+// statFields returns a column for each selected stat, with a row for each activity.
+func statFields(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, stats []string, activityHistory []bungie.DestinyHistoricalStatsPeriodGroup) ([]*data.Field, error) {
+	statKeys := selectedStatKeys(stats, activityHistory)
+	if len(statKeys) == 0 {
+		return nil, nil
+	}
+
+	statDefs, err := bungieAPIClient.GetHistoricalStatsDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get stat definitions: %w", err)
+	}
+
+	fields := make([]*data.Field, 0, len(statKeys))
+
+	for _, statKey := range statKeys {
+		values := make([]*float64, len(activityHistory))
+		for i, activity := range activityHistory {
+			if stat, ok := activity.Values[statKey]; ok {
+				value := stat.Basic.Value
+				values[i] = &value
+			}
+		}
+
+		fields = append(fields, newStatField(statKey, statDefs[statKey], values))
+	}
+
+	return fields, nil
+}
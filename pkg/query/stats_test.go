@@ -0,0 +1,64 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+func TestSelectedStatKeys(t *testing.T) {
+	activityHistory := []bungie.DestinyHistoricalStatsPeriodGroup{
+		testActivity(time.Now(), 1, 10, 5),
+	}
+
+	tests := []struct {
+		name     string
+		stats    []string
+		expected []string
+	}{
+		{"no stats", nil, nil},
+		{"selected stats", []string{"kills", "assists"}, []string{"kills", "assists"}},
+		{"stats with their own columns", []string{"kills", "completed", "standing", "timePlayedSeconds", "kills"}, []string{"kills"}},
+		{"all stats", []string{StatsAll}, []string{"deaths", "kills"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statKeys := selectedStatKeys(test.stats, activityHistory)
+			if strings.Join(statKeys, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("expected stat keys %v, got %v", test.expected, statKeys)
+			}
+		})
+	}
+}
+
+func TestNewStatField(t *testing.T) {
+	one := 1.0
+	values := []*float64{&one, nil}
+
+	field := newStatField("completed", &bungie.DestinyHistoricalStatsDefinition{StatName: "Completed", UnitType: bungie.UnitTypeBoolean}, values)
+	if field.Name != "Completed" {
+		t.Errorf("expected the stat's name from its definition, got %v", field.Name)
+	}
+	if value := field.At(0).(*bool); value == nil || !*value {
+		t.Errorf("expected a boolean stat, got %v", field.At(0))
+	}
+	if field.At(1).(*bool) != nil {
+		t.Error("expected activities without the stat to be null")
+	}
+
+	field = newStatField("secondsPlayed", &bungie.DestinyHistoricalStatsDefinition{UnitType: bungie.UnitTypeSeconds}, values)
+	if field.Name != "secondsPlayed" || field.Config == nil || field.Config.Unit != "s" {
+		t.Errorf("expected a stat without a name to use its key, with seconds units, got %v %v", field.Name, field.Config)
+	}
+	if value := field.At(0).(*int64); value == nil || *value != 1 {
+		t.Errorf("expected an integer stat, got %v", field.At(0))
+	}
+
+	field = newStatField("unknownStat", nil, values)
+	if value := field.At(0).(*float64); value == nil || *value != 1 {
+		t.Errorf("expected stats without definitions to be floats, got %v", field.At(0))
+	}
+}
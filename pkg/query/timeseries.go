@@ -0,0 +1,185 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	SplitByNone         = ""
+	SplitByActivityMode = "activityMode"
+	SplitByCharacter    = "character"
+)
+
+var (
+	MIN_BUCKET_SIZE = time.Minute
+	MAX_BUCKETS     = 5000
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeActivityTimeSeries, QueryActivityTimeSeries)
+}
+
+// activityBuckets accumulates per-bucket totals for one series of the time series.
+type activityBuckets struct {
+	activities    []int64
+	secondsPlayed []int64
+	completions   []int64
+	kills         []int64
+}
+
+func newActivityBuckets(bucketCount int) *activityBuckets {
+	return &activityBuckets{
+		activities:    make([]int64, bucketCount),
+		secondsPlayed: make([]int64, bucketCount),
+		completions:   make([]int64, bucketCount),
+		kills:         make([]int64, bucketCount),
+	}
+}
+
+func (buckets *activityBuckets) add(bucketIndex int, activity bungie.DestinyHistoricalStatsPeriodGroup) {
+	buckets.activities[bucketIndex] += 1
+	buckets.secondsPlayed[bucketIndex] += int64(activity.Values["timePlayedSeconds"].Basic.Value)
+	buckets.kills[bucketIndex] += int64(activity.Values["kills"].Basic.Value)
+
+	if activity.Values["completed"].Basic.Value == 1 {
+		buckets.completions[bucketIndex] += 1
+	}
+}
+
+// bucketSize is the user chosen bucket size, or the panel's interval when none is set.
+func bucketSize(dataQuery backend.DataQuery, queryModel QueryModel) (time.Duration, error) {
+	size := dataQuery.Interval
+
+	if queryModel.BucketSize != "" {
+		parsedSize, err := gtime.ParseDuration(queryModel.BucketSize)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bucket size %q", queryModel.BucketSize)
+		}
+
+		size = parsedSize
+	}
+
+	if size < MIN_BUCKET_SIZE {
+		size = MIN_BUCKET_SIZE
+	}
+
+	// Grow the buckets rather than returning an unreasonably large frame for long time ranges
+	rangeDuration := dataQuery.TimeRange.To.Sub(dataQuery.TimeRange.From)
+	if rangeDuration/size > time.Duration(MAX_BUCKETS) {
+		size = rangeDuration / time.Duration(MAX_BUCKETS)
+	}
+
+	return size, nil
+}
+
+func QueryActivityTimeSeries(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	switch queryModel.SplitBy {
+	case SplitByNone, SplitByActivityMode, SplitByCharacter:
+	default:
+		return nil, fmt.Errorf("unknown split by %q", queryModel.SplitBy)
+	}
+
+	size, err := bucketSize(dataQuery, queryModel)
+	if err != nil {
+		return nil, err
+	}
+
+	firstBucket := dataQuery.TimeRange.From.Truncate(size)
+	bucketCount := int(dataQuery.TimeRange.To.Sub(firstBucket)/size) + 1
+
+	characters := queryModel.characters()
+	characterNames := map[string]string{}
+	if queryModel.SplitBy == SplitByCharacter {
+		characterNames, err = requestCharacterNames(ctx, bungieAPIClient, characters, queryModel.profileErrors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	activityHistoryByCharacter, err := requestActivityHistoryByCharacter(ctx, bungieAPIClient, queryModel, dataQuery.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesBuckets := map[string]*activityBuckets{}
+
+	for i, character := range characters {
+		characterName := characterLabel(character, characterNames)
+
+		for _, activity := range activityHistoryByCharacter[i] {
+			var seriesName string
+
+			switch queryModel.SplitBy {
+			case SplitByActivityMode:
+				seriesName, err = activityModeName(ctx, bungieAPIClient, int(activity.ActivityDetails.Mode))
+				if err != nil {
+					return nil, err
+				}
+			case SplitByCharacter:
+				seriesName = characterName
+			}
+
+			buckets, ok := seriesBuckets[seriesName]
+			if !ok {
+				buckets = newActivityBuckets(bucketCount)
+				seriesBuckets[seriesName] = buckets
+			}
+
+			bucketIndex := int(activity.Period.Sub(firstBucket) / size)
+			if bucketIndex < 0 || bucketIndex >= bucketCount {
+				continue
+			}
+
+			buckets.add(bucketIndex, activity)
+		}
+	}
+
+	// Without a split, an empty range should still draw a flat line rather than no data
+	if queryModel.SplitBy == SplitByNone && len(seriesBuckets) == 0 {
+		seriesBuckets[""] = newActivityBuckets(bucketCount)
+	}
+
+	seriesNames := make([]string, 0, len(seriesBuckets))
+	for seriesName := range seriesBuckets {
+		seriesNames = append(seriesNames, seriesName)
+	}
+	sort.Strings(seriesNames)
+
+	bucketTimes := make([]time.Time, bucketCount)
+	for i := range bucketTimes {
+		bucketTimes[i] = firstBucket.Add(size * time.Duration(i))
+	}
+
+	frames := data.Frames{}
+
+	for _, seriesName := range seriesNames {
+		buckets := seriesBuckets[seriesName]
+
+		var labels data.Labels
+		if queryModel.SplitBy != SplitByNone {
+			labels = data.Labels{queryModel.SplitBy: seriesName}
+		}
+
+		frame := data.NewFrame("response",
+			data.NewField("Time", nil, bucketTimes),
+			data.NewField("Activities", labels, buckets.activities),
+			data.NewField("Seconds played", labels, buckets.secondsPlayed).SetConfig(&data.FieldConfig{Unit: "s"}),
+			data.NewField("Completions", labels, buckets.completions),
+			data.NewField("Kills", labels, buckets.kills),
+		)
+
+		frames = append(frames, frame)
+	}
+
+	return addProfileNoticesToFrames(frames, queryModel.profileErrors), nil
+}
@@ -0,0 +1,107 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestBucketSize(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := backend.TimeRange{From: from, To: from.Add(time.Hour * 24)}
+
+	tests := []struct {
+		name      string
+		dataQuery backend.DataQuery
+		model     QueryModel
+		expected  time.Duration
+	}{
+		{"panel interval", backend.DataQuery{Interval: time.Minute * 5, TimeRange: day}, QueryModel{}, time.Minute * 5},
+		{"chosen bucket size", backend.DataQuery{Interval: time.Minute * 5, TimeRange: day}, QueryModel{BucketSize: "1h"}, time.Hour},
+		{"minimum bucket size", backend.DataQuery{Interval: time.Second, TimeRange: day}, QueryModel{}, MIN_BUCKET_SIZE},
+		{"grown to MAX_BUCKETS", backend.DataQuery{Interval: time.Minute, TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour * 24 * 365)}}, QueryModel{}, time.Hour * 24 * 365 / time.Duration(MAX_BUCKETS)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			size, err := bucketSize(test.dataQuery, test.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size != test.expected {
+				t.Errorf("expected bucket size %v, got %v", test.expected, size)
+			}
+
+			rangeDuration := test.dataQuery.TimeRange.To.Sub(test.dataQuery.TimeRange.From)
+			if buckets := int(rangeDuration / size); buckets > MAX_BUCKETS {
+				t.Errorf("expected at most %v buckets, got %v", MAX_BUCKETS, buckets)
+			}
+		})
+	}
+}
+
+func TestBucketSizeInvalid(t *testing.T) {
+	_, err := bucketSize(backend.DataQuery{}, QueryModel{BucketSize: "not a duration"})
+	if err == nil {
+		t.Error("expected an invalid bucket size error")
+	}
+}
+
+func TestActivityTimeSeriesBuckets(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Account/1/Character/10/Stats/Activities/": `{ "activities": [
+			{ "period": "2024-01-01T01:20:00Z", "activityDetails": { "mode": 4 }, "values": { "kills": { "basic": { "value": 5 } }, "completed": { "basic": { "value": 1 } }, "timePlayedSeconds": { "basic": { "value": 300 } } } },
+			{ "period": "2024-01-01T01:00:00Z", "activityDetails": { "mode": 4 }, "values": { "kills": { "basic": { "value": 2 } }, "timePlayedSeconds": { "basic": { "value": 60 } } } },
+			{ "period": "2024-01-01T00:45:00Z", "activityDetails": { "mode": 4 }, "values": { "kills": { "basic": { "value": 7 } }, "completed": { "basic": { "value": 1 } }, "timePlayedSeconds": { "basic": { "value": 600 } } } }
+		] }`,
+	}, nil)
+
+	from := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	dataQuery := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour * 2)}}
+	queryModel := QueryModel{
+		QueryType:  QueryTypeActivityTimeSeries,
+		Profile:    bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+		Characters: []string{"10"},
+		BucketSize: "1h",
+	}
+
+	frames, err := Run(context.Background(), client, dataQuery, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 1 {
+		t.Fatalf("expected a single series without a split, got %v", len(frames))
+	}
+
+	frame := frames[0]
+	expectedFields := []string{"Time", "Activities", "Seconds played", "Completions", "Kills"}
+	if strings.Join(fieldNames(frame), ",") != strings.Join(expectedFields, ",") {
+		t.Fatalf("unexpected fields %v", fieldNames(frame))
+	}
+
+	// Buckets are aligned to the bucket size, so the first starts before the time range does
+	expectedTimes := []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC),
+	}
+	if frame.Rows() != len(expectedTimes) {
+		t.Fatalf("expected %v buckets, got %v", len(expectedTimes), frame.Rows())
+	}
+
+	expectedActivities := []int64{1, 2, 0}
+	expectedKills := []int64{7, 7, 0}
+	for i, expectedTime := range expectedTimes {
+		row := frame.RowCopy(i)
+		if row[0] != expectedTime || row[1] != expectedActivities[i] || row[4] != expectedKills[i] {
+			t.Errorf("unexpected bucket %v: %v", i, row)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var (
+	TRIUMPHS_COMPONENTS = []int{
+		bungie.DestinyComponentTypeProfiles,
+		bungie.DestinyComponentTypePresentationNodes,
+		bungie.DestinyComponentTypeRecords,
+	}
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeTriumphs, QueryTriumphs)
+}
+
+// recordProgress totals a record's objectives, capping each at its completion value so
+// over-completed objectives don't hide the others.
+func recordProgress(record bungie.DestinyRecordComponent) (int64, int64) {
+	var progress, completionValue int64
+
+	for _, objective := range record.Objectives {
+		objectiveProgress := objective.Progress
+		if objectiveProgress > objective.CompletionValue {
+			objectiveProgress = objective.CompletionValue
+		}
+
+		progress += int64(objectiveProgress)
+		completionValue += int64(objective.CompletionValue)
+	}
+
+	return progress, completionValue
+}
+
+func progressRatio(progress int64, completionValue int64) float64 {
+	if completionValue == 0 {
+		return 0
+	}
+
+	return float64(progress) / float64(completionValue)
+}
+
+// QueryTriumphs returns the progress of each record beneath the query's presentation node, or
+// beneath every seal when no node is given, along with each seal's overall progress.
+func QueryTriumphs(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	profiles, err := requestPresentationProfiles(ctx, bungieAPIClient, queryModel, TRIUMPHS_COMPONENTS)
+	if err != nil {
+		return nil, err
+	}
+
+	recordDefs, err := bungieAPIClient.GetRecordDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get record definitions: %w", err)
+	}
+
+	nodeDefs, err := bungieAPIClient.GetPresentationNodeDefinitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get presentation node definitions: %w", err)
+	}
+
+	includePlayerColumn := len(queryModel.Profiles) > 1
+
+	recordsFrame := triumphRecordsFrame(profiles, recordDefs, nodeDefs, queryModel.PresentationNodeHash, includePlayerColumn)
+	sealsFrame := sealsFrame(profiles, recordDefs, nodeDefs, queryModel.PresentationNodeHash, includePlayerColumn)
+	addProfileNotices(recordsFrame, queryModel.profileErrors)
+
+	return data.Frames{recordsFrame, sealsFrame}, nil
+}
+
+func triumphRecordsFrame(profiles []presentationProfile, recordDefs bungieAPI.RecordDefinitionMap, nodeDefs bungieAPI.PresentationNodeDefinitionMap, presentationNodeHash int, includePlayerColumn bool) *data.Frame {
+	playerField := data.NewField("Player", nil, []string{})
+	nodeField := data.NewField("Category", nil, []string{})
+	recordField := data.NewField("Triumph", nil, []string{})
+	descriptionField := data.NewField("Description", nil, []string{})
+	progressField := data.NewField("Progress", nil, []int64{})
+	completionValueField := data.NewField("Completion value", nil, []int64{})
+	percentField := data.NewField("Percent complete", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+	completedField := data.NewField("Completed", nil, []bool{})
+	redeemedField := data.NewField("Redeemed", nil, []bool{})
+
+	for _, triumphs := range profiles {
+		rootNodeHash := presentationNodeHash
+		if rootNodeHash == 0 {
+			rootNodeHash = triumphs.profile.ProfileRecords.Data.RecordSealsRootNodeHash
+		}
+
+		for _, nodeDef := range nodesUnderNode(nodeDefs, rootNodeHash) {
+			for _, child := range nodeDef.Children.Records {
+				recordDef := recordDefs[child.RecordHash]
+				if recordDef == nil || recordDef.Redacted {
+					continue
+				}
+
+				record, ok := triumphs.record(recordDef)
+				if !ok || record.State&bungie.DestinyRecordStateInvisible != 0 {
+					continue
+				}
+
+				progress, completionValue := recordProgress(record)
+
+				playerField.Append(triumphs.player)
+				nodeField.Append(nodeDef.DisplayProperties.Name)
+				recordField.Append(recordDef.DisplayProperties.Name)
+				descriptionField.Append(recordDef.DisplayProperties.Description)
+				progressField.Append(progress)
+				completionValueField.Append(completionValue)
+				percentField.Append(progressRatio(progress, completionValue))
+				completedField.Append(record.State&bungie.DestinyRecordStateObjectiveNotCompleted == 0)
+				redeemedField.Append(record.State&bungie.DestinyRecordStateRecordRedeemed != 0)
+			}
+		}
+	}
+
+	frame := data.NewFrame("records")
+	if includePlayerColumn {
+		frame.Fields = append(frame.Fields, playerField)
+	}
+	frame.Fields = append(frame.Fields,
+		nodeField,
+		recordField,
+		descriptionField,
+		progressField,
+		completionValueField,
+		percentField,
+		completedField,
+		redeemedField,
+	)
+
+	return frame
+}
+
+// sealsFrame returns the progress of each seal. When the query's presentation node is a seal only
+// that seal is included, and other nodes leave out the seals entirely.
+func sealsFrame(profiles []presentationProfile, recordDefs bungieAPI.RecordDefinitionMap, nodeDefs bungieAPI.PresentationNodeDefinitionMap, presentationNodeHash int, includePlayerColumn bool) *data.Frame {
+	playerField := data.NewField("Player", nil, []string{})
+	sealField := data.NewField("Seal", nil, []string{})
+	titleField := data.NewField("Title", nil, []string{})
+	progressField := data.NewField("Progress", nil, []int64{})
+	completionValueField := data.NewField("Completion value", nil, []int64{})
+	percentField := data.NewField("Percent complete", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+	completedField := data.NewField("Completed", nil, []bool{})
+
+	for _, triumphs := range profiles {
+		sealsRootDef := nodeDefs[triumphs.profile.ProfileRecords.Data.RecordSealsRootNodeHash]
+		if sealsRootDef == nil {
+			continue
+		}
+
+		for _, child := range sealsRootDef.Children.PresentationNodes {
+			isSelectedSeal := child.PresentationNodeHash == presentationNodeHash
+			if presentationNodeHash != 0 && presentationNodeHash != sealsRootDef.Hash && !isSelectedSeal {
+				continue
+			}
+
+			sealDef := nodeDefs[child.PresentationNodeHash]
+			if sealDef == nil || sealDef.Redacted {
+				continue
+			}
+
+			node, ok := triumphs.presentationNode(sealDef)
+			if !ok {
+				continue
+			}
+
+			var title string
+			if completionRecordDef := recordDefs[sealDef.CompletionRecordHash]; completionRecordDef != nil {
+				title = completionRecordDef.TitleInfo.Title()
+			}
+
+			progress := int64(node.ProgressValue)
+			completionValue := int64(node.CompletionValue)
+
+			playerField.Append(triumphs.player)
+			sealField.Append(sealDef.DisplayProperties.Name)
+			titleField.Append(title)
+			progressField.Append(progress)
+			completionValueField.Append(completionValue)
+			percentField.Append(progressRatio(progress, completionValue))
+			completedField.Append(completionValue > 0 && progress >= completionValue)
+		}
+	}
+
+	frame := data.NewFrame("seals")
+	if includePlayerColumn {
+		frame.Fields = append(frame.Fields, playerField)
+	}
+	frame.Fields = append(frame.Fields,
+		sealField,
+		titleField,
+		progressField,
+		completionValueField,
+		percentField,
+		completedField,
+	)
+
+	return frame
+}
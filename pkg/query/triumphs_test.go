@@ -0,0 +1,21 @@
+package query
+
+import (
+	"testing"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+)
+
+func TestRecordProgressCapsOvercompletedObjectives(t *testing.T) {
+	record := bungie.DestinyRecordComponent{
+		Objectives: []bungie.DestinyObjectiveProgress{
+			{Progress: 250, CompletionValue: 100},
+			{Progress: 10, CompletionValue: 100},
+		},
+	}
+
+	progress, completionValue := recordProgress(record)
+	if progress != 110 || completionValue != 200 {
+		t.Errorf("expected 110/200, got %v/%v", progress, completionValue)
+	}
+}
@@ -0,0 +1,306 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"sort"
+	"strconv"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// Lifetime weapon stats from the unique weapons endpoint
+	WeaponSourceLifetime = "lifetime"
+	// Weapon stats from the PGCRs of activities within the time range
+	WeaponSourceTimeRange = "timeRange"
+)
+
+func init() {
+	RegisterQueryHandler(QueryTypeWeaponUsage, QueryWeaponUsage)
+}
+
+type weaponUsage struct {
+	referenceId    int
+	kills          int64
+	precisionKills int64
+}
+
+func (usage *weaponUsage) add(values map[string]bungie.DestinyHistoricalStatsValue) {
+	usage.kills += int64(values["uniqueWeaponKills"].Basic.Value)
+	usage.precisionKills += int64(values["uniqueWeaponPrecisionKills"].Basic.Value)
+}
+
+func (usage *weaponUsage) precisionRatio() float64 {
+	if usage.kills == 0 {
+		return 0
+	}
+
+	return float64(usage.precisionKills) / float64(usage.kills)
+}
+
+// weaponUsageByPeriod is weapon usage keyed by reference ID, for each bucket of time.
+type weaponUsageByPeriod map[time.Time]map[int]*weaponUsage
+
+func (usageByPeriod weaponUsageByPeriod) add(period time.Time, weapon bungie.DestinyHistoricalWeaponStats) {
+	usageByWeapon, ok := usageByPeriod[period]
+	if !ok {
+		usageByWeapon = map[int]*weaponUsage{}
+		usageByPeriod[period] = usageByWeapon
+	}
+
+	usage, ok := usageByWeapon[weapon.ReferenceId]
+	if !ok {
+		usage = &weaponUsage{referenceId: weapon.ReferenceId}
+		usageByWeapon[weapon.ReferenceId] = usage
+	}
+
+	usage.add(weapon.Values)
+}
+
+func requestLifetimeWeaponUsage(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, queryModel QueryModel) (weaponUsageByPeriod, error) {
+	usageByPeriod := weaponUsageByPeriod{}
+
+	for _, character := range queryModel.characters() {
+		weapons, err := bungieAPIClient.RequestUniqueWeaponStats(ctx, character.membership.MembershipType, character.membership.MembershipId, character.characterId)
+		if err != nil && queryModel.profileErrors != nil {
+			// Leave out the player's weapons rather than failing every profile of the query
+			queryModel.profileErrors.add(character.player, fmt.Errorf("unable to get weapon stats: %w", err))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get weapon stats: %w", err)
+		}
+
+		for _, weapon := range weapons {
+			usageByPeriod.add(time.Time{}, weapon)
+		}
+	}
+
+	return usageByPeriod, nil
+}
+
+// requestTimeRangeWeaponUsage totals the queried characters' weapon stats from the PGCRs in the
+// time range, bucketed by the activity's start when bucketSize is non-zero. Only the most recent
+// MAX_WEAPON_USAGE_PGCRS activities are included, and a notice is returned when any are left out.
+func requestTimeRangeWeaponUsage(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel, bucketSize time.Duration) (weaponUsageByPeriod, *data.Notice, error) {
+	// The PGCRs have to come from the profile's activity history, not arbitrary instance IDs
+	queryModel.InstanceIds = nil
+	instanceIds, err := requestInstanceIds(ctx, bungieAPIClient, dataQuery, queryModel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Instance IDs are newest first
+	var notice *data.Notice
+	if len(instanceIds) > MAX_WEAPON_USAGE_PGCRS {
+		notice = &data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Only the %v most recent of the %v activities in the time range are included. Narrow the time range to include them all", MAX_WEAPON_USAGE_PGCRS, len(instanceIds)),
+		}
+		instanceIds = instanceIds[:MAX_WEAPON_USAGE_PGCRS]
+	}
+
+	pgcrs, err := requestPostGameCarnageReports(ctx, bungieAPIClient, instanceIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	characterIds := map[int64]bool{}
+	for _, character := range queryModel.characters() {
+		parsedCharacterId, err := strconv.ParseInt(character.characterId, 10, 64)
+		if err == nil {
+			characterIds[parsedCharacterId] = true
+		}
+	}
+
+	usageByPeriod := weaponUsageByPeriod{}
+
+	for _, pgcr := range pgcrs {
+		var period time.Time
+		if bucketSize > 0 {
+			period = pgcr.Period.Truncate(bucketSize)
+		}
+
+		for _, entry := range pgcr.Entries {
+			if !characterIds[entry.CharacterId] {
+				continue
+			}
+
+			for _, weapon := range entry.Extended.Weapons {
+				usageByPeriod.add(period, weapon)
+			}
+		}
+	}
+
+	return usageByPeriod, notice, nil
+}
+
+func QueryWeaponUsage(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, dataQuery backend.DataQuery, queryModel QueryModel) (data.Frames, error) {
+	var usageByPeriod weaponUsageByPeriod
+	var notice *data.Notice
+	var size time.Duration
+	var err error
+	bucketed := false
+
+	switch queryModel.WeaponSource {
+	case "", WeaponSourceLifetime:
+		usageByPeriod, err = requestLifetimeWeaponUsage(ctx, bungieAPIClient, queryModel)
+	case WeaponSourceTimeRange:
+		if queryModel.BucketSize != "" {
+			bucketed = true
+			size, err = bucketSize(dataQuery, queryModel)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		usageByPeriod, notice, err = requestTimeRangeWeaponUsage(ctx, bungieAPIClient, dataQuery, queryModel, size)
+	default:
+		return nil, fmt.Errorf("unknown weapon source %q", queryModel.WeaponSource)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var frames data.Frames
+	if bucketed {
+		frames, err = weaponUsageTimeSeriesFrames(ctx, bungieAPIClient, usageByPeriod, dataQuery.TimeRange, size)
+	} else {
+		frames, err = weaponUsageTableFrames(ctx, bungieAPIClient, usageByPeriod[time.Time{}])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if notice != nil {
+		if len(frames) == 0 {
+			frames = append(frames, data.NewFrame("response"))
+		}
+		frames[0].AppendNotices(*notice)
+	}
+
+	return addProfileNoticesToFrames(frames, queryModel.profileErrors), nil
+}
+
+func weaponNameAndType(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, referenceId int) (string, string, error) {
+	def, err := bungieAPIClient.GetInventoryItemDefinitionForHash(ctx, referenceId)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get item definitions: %w", err)
+	}
+
+	if def == nil {
+		return strconv.Itoa(referenceId), "", nil
+	}
+
+	return def.DisplayProperties.Name, def.ItemTypeDisplayName, nil
+}
+
+// weaponUsageTableFrames returns a row for each weapon, most kills first.
+func weaponUsageTableFrames(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, usageByWeapon map[int]*weaponUsage) (data.Frames, error) {
+	allUsage := make([]*weaponUsage, 0, len(usageByWeapon))
+	for _, usage := range usageByWeapon {
+		allUsage = append(allUsage, usage)
+	}
+
+	sort.Slice(allUsage, func(i, j int) bool {
+		if allUsage[i].kills != allUsage[j].kills {
+			return allUsage[i].kills > allUsage[j].kills
+		}
+
+		return allUsage[i].referenceId < allUsage[j].referenceId
+	})
+
+	weaponField := data.NewField("Weapon", nil, []string{})
+	weaponTypeField := data.NewField("Weapon type", nil, []string{})
+	killsField := data.NewField("Kills", nil, []int64{})
+	precisionKillsField := data.NewField("Precision kills", nil, []int64{})
+	precisionRatioField := data.NewField("Precision ratio", nil, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+
+	for _, usage := range allUsage {
+		name, weaponType, err := weaponNameAndType(ctx, bungieAPIClient, usage.referenceId)
+		if err != nil {
+			return nil, err
+		}
+
+		weaponField.Append(name)
+		weaponTypeField.Append(weaponType)
+		killsField.Append(usage.kills)
+		precisionKillsField.Append(usage.precisionKills)
+		precisionRatioField.Append(usage.precisionRatio())
+	}
+
+	frame := data.NewFrame("response",
+		weaponField,
+		weaponTypeField,
+		killsField,
+		precisionKillsField,
+		precisionRatioField,
+	)
+
+	return data.Frames{frame}, nil
+}
+
+// weaponUsageTimeSeriesFrames returns a time series frame for each weapon, labelled by the weapon's name,
+// with a value for every bucket in the time range.
+func weaponUsageTimeSeriesFrames(ctx context.Context, bungieAPIClient *bungieAPI.BungieAPI, usageByPeriod weaponUsageByPeriod, timeRange backend.TimeRange, size time.Duration) (data.Frames, error) {
+	firstBucket := timeRange.From.Truncate(size)
+	bucketCount := int(timeRange.To.Sub(firstBucket)/size) + 1
+
+	periods := make([]time.Time, 0, bucketCount)
+	for i := 0; i < bucketCount; i++ {
+		periods = append(periods, firstBucket.Add(size*time.Duration(i)))
+	}
+
+	referenceIds := map[int]bool{}
+	for _, usageByWeapon := range usageByPeriod {
+		for referenceId := range usageByWeapon {
+			referenceIds[referenceId] = true
+		}
+	}
+
+	sortedReferenceIds := make([]int, 0, len(referenceIds))
+	for referenceId := range referenceIds {
+		sortedReferenceIds = append(sortedReferenceIds, referenceId)
+	}
+	sort.Ints(sortedReferenceIds)
+
+	frames := data.Frames{}
+
+	for _, referenceId := range sortedReferenceIds {
+		name, _, err := weaponNameAndType(ctx, bungieAPIClient, referenceId)
+		if err != nil {
+			return nil, err
+		}
+
+		labels := data.Labels{"weapon": name}
+		timeField := data.NewField("Time", nil, []time.Time{})
+		killsField := data.NewField("Kills", labels, []int64{})
+		precisionKillsField := data.NewField("Precision kills", labels, []int64{})
+		precisionRatioField := data.NewField("Precision ratio", labels, []float64{}).SetConfig(&data.FieldConfig{Unit: "percentunit"})
+
+		for _, period := range periods {
+			usage, ok := usageByPeriod[period][referenceId]
+			if !ok {
+				usage = &weaponUsage{referenceId: referenceId}
+			}
+
+			timeField.Append(period)
+			killsField.Append(usage.kills)
+			precisionKillsField.Append(usage.precisionKills)
+			precisionRatioField.Append(usage.precisionRatio())
+		}
+
+		frame := data.NewFrame("response", timeField, killsField, precisionKillsField, precisionRatioField)
+		frame.SetMeta(&data.FrameMeta{Type: data.FrameTypeTimeSeriesWide})
+
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,168 @@
+package query
+
+import (
+	"context"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"strings"
+	"testing"
+	"time"
+
+	bungie "github.com/joshhunt/bungieapigo/pkg/models"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var testWeaponDefinitions = map[string]string{
+	"DestinyInventoryItemDefinition": `{
+		"1": { "hash": 1, "displayProperties": { "name": "Ace of Spades" }, "itemTypeDisplayName": "Hand Cannon" },
+		"2": { "hash": 2, "displayProperties": { "name": "Gjallarhorn" }, "itemTypeDisplayName": "Rocket Launcher" }
+	}`,
+}
+
+func TestLifetimeWeaponUsage(t *testing.T) {
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Account/1/Character/10/Stats/UniqueWeapons/": `{ "weapons": [
+			{ "referenceId": 1, "values": { "uniqueWeaponKills": { "basic": { "value": 10 } }, "uniqueWeaponPrecisionKills": { "basic": { "value": 5 } } } },
+			{ "referenceId": 2, "values": { "uniqueWeaponKills": { "basic": { "value": 30 } } } }
+		] }`,
+		"/Platform/Destiny2/3/Account/1/Character/11/Stats/UniqueWeapons/": `{ "weapons": [
+			{ "referenceId": 1, "values": { "uniqueWeaponKills": { "basic": { "value": 30 } }, "uniqueWeaponPrecisionKills": { "basic": { "value": 15 } } } },
+			{ "referenceId": 3, "values": { "uniqueWeaponKills": { "basic": { "value": 1 } } } }
+		] }`,
+	}, testWeaponDefinitions)
+
+	queryModel := QueryModel{
+		QueryType:  QueryTypeWeaponUsage,
+		Profile:    bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+		Characters: []string{"10", "11"},
+	}
+
+	frames, err := Run(context.Background(), client, backend.DataQuery{RefID: "A"}, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	expectedFields := []string{"Weapon", "Weapon type", "Kills", "Precision kills", "Precision ratio"}
+	if strings.Join(fieldNames(frame), ",") != strings.Join(expectedFields, ",") {
+		t.Fatalf("unexpected fields %v", fieldNames(frame))
+	}
+
+	// Weapons are totalled across the selected characters, most kills first
+	expectedRows := [][]interface{}{
+		{"Ace of Spades", "Hand Cannon", int64(40), int64(20), 0.5},
+		{"Gjallarhorn", "Rocket Launcher", int64(30), int64(0), 0.0},
+		{"3", "", int64(1), int64(0), 0.0},
+	}
+	if frame.Rows() != len(expectedRows) {
+		t.Fatalf("expected %v weapons, got %v", len(expectedRows), frame.Rows())
+	}
+
+	for i, expectedRow := range expectedRows {
+		row := frame.RowCopy(i)
+		for j := range expectedRow {
+			if row[j] != expectedRow[j] {
+				t.Errorf("unexpected row %v: %v", i, row)
+				break
+			}
+		}
+	}
+}
+
+func TestWeaponUsageTimeSeriesFrames(t *testing.T) {
+	client := newFakeBungieClient(t, nil, testWeaponDefinitions)
+
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	usageByPeriod := weaponUsageByPeriod{}
+	usageByPeriod.add(second, bungie.DestinyHistoricalWeaponStats{ReferenceId: 2, Values: map[string]bungie.DestinyHistoricalStatsValue{
+		"uniqueWeaponKills": {Basic: bungie.DestinyHistoricalStatsValuePair{Value: 3}},
+	}})
+	usageByPeriod.add(first, bungie.DestinyHistoricalWeaponStats{ReferenceId: 1, Values: map[string]bungie.DestinyHistoricalStatsValue{
+		"uniqueWeaponKills": {Basic: bungie.DestinyHistoricalStatsValuePair{Value: 4}},
+	}})
+
+	// The last bucket has no activities, but still needs a value
+	timeRange := backend.TimeRange{From: first.Add(time.Minute * 10), To: second.Add(time.Hour * 3 / 2)}
+	frames, err := weaponUsageTimeSeriesFrames(context.Background(), client, usageByPeriod, timeRange, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("expected a frame per weapon, got %v", len(frames))
+	}
+
+	for i, expected := range []struct {
+		weapon string
+		kills  []int64
+	}{
+		{"Ace of Spades", []int64{4, 0, 0}},
+		{"Gjallarhorn", []int64{0, 3, 0}},
+	} {
+		frame := frames[i]
+		if frame.Meta == nil || frame.Meta.Type != data.FrameTypeTimeSeriesWide {
+			t.Errorf("expected a wide time series frame, got %v", frame.Meta)
+		}
+
+		if frame.Fields[0].Len() != 3 || frame.Fields[0].At(0) != first || frame.Fields[0].At(1) != second {
+			t.Errorf("expected every bucket of the time range in each frame, in order")
+		}
+
+		killsField := frame.Fields[1]
+		if killsField.Labels["weapon"] != expected.weapon {
+			t.Errorf("expected the frame to be labelled %v, got %v", expected.weapon, killsField.Labels)
+		}
+
+		for j, kills := range expected.kills {
+			if killsField.At(j) != kills {
+				t.Errorf("expected %v kills for %v in period %v, got %v", kills, expected.weapon, j, killsField.At(j))
+			}
+		}
+	}
+}
+
+func TestTimeRangeWeaponUsageCapsPostGameCarnageReports(t *testing.T) {
+	originalMax := MAX_WEAPON_USAGE_PGCRS
+	MAX_WEAPON_USAGE_PGCRS = 1
+	defer func() { MAX_WEAPON_USAGE_PGCRS = originalMax }()
+
+	// Only the newest activity's PGCR is served, so requesting the other fails the test
+	client := newFakeBungieClient(t, map[string]string{
+		"/Platform/Destiny2/3/Profile/1/LinkedProfiles/": `{ "profiles": [] }`,
+		"/Platform/Destiny2/3/Account/1/Character/10/Stats/Activities/": `{ "activities": [
+			{ "period": "2024-01-01T01:20:00Z", "activityDetails": { "instanceId": "100" } },
+			{ "period": "2024-01-01T00:45:00Z", "activityDetails": { "instanceId": "101" } }
+		] }`,
+		"/Platform/Destiny2/Stats/PostGameCarnageReport/100/": `{
+			"period": "2024-01-01T01:20:00Z",
+			"entries": [{ "characterId": "10", "extended": { "weapons": [{ "referenceId": 1, "values": { "uniqueWeaponKills": { "basic": { "value": 6 } } } }] } }]
+		}`,
+	}, testWeaponDefinitions)
+
+	from := time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)
+	dataQuery := backend.DataQuery{RefID: "A", TimeRange: backend.TimeRange{From: from, To: from.Add(time.Hour * 2)}}
+	queryModel := QueryModel{
+		QueryType:    QueryTypeWeaponUsage,
+		Profile:      bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "1"},
+		Characters:   []string{"10"},
+		WeaponSource: WeaponSourceTimeRange,
+	}
+
+	frames, err := Run(context.Background(), client, dataQuery, queryModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := frames[0]
+	if frame.Rows() != 1 || frame.Fields[2].At(0) != int64(6) {
+		t.Errorf("expected only the newest activity's weapons, got %v rows", frame.Rows())
+	}
+
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || !strings.Contains(frame.Meta.Notices[0].Text, "Only the 1 most recent of the 2 activities") {
+		t.Errorf("expected a notice that activities were left out, got %+v", frame.Meta)
+	}
+}
@@ -0,0 +1,226 @@
+package snapshots
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	backend "github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+var (
+	// Longest line read from a snapshot file. Snapshots are a few hundred values at most, so
+	// anything longer is a corrupt file.
+	MAX_SNAPSHOT_SIZE = 1024 * 1024
+	// How long snapshots are kept for when the store isn't given a retention
+	DEFAULT_SNAPSHOT_RETENTION = time.Hour * 24 * 365
+)
+
+// Snapshots are rotated into a file per month, named by the month they were recorded in
+const monthFileLayout = "2006-01"
+
+// Snapshot is the value of each recorded series for a profile at a point in time.
+type Snapshot struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+// Store persists snapshots between plugin restarts, as JSON Lines files laid out as
+// <dir>/<membership type>-<membership id>/<year>-<month>.jsonl. Snapshots are only ever appended,
+// in time order, and whole months are deleted once they're older than the retention.
+type Store struct {
+	dir       string
+	retention time.Duration
+
+	// Lock per membership, so reading one profile's snapshots doesn't hold up recording another's
+	locks sync.Map
+}
+
+// NewStore creates a store in dir that keeps snapshots for the retention, or
+// DEFAULT_SNAPSHOT_RETENTION when it's zero.
+func NewStore(dir string, retention time.Duration) *Store {
+	if retention <= 0 {
+		retention = DEFAULT_SNAPSHOT_RETENTION
+	}
+
+	return &Store{dir: dir, retention: retention}
+}
+
+func (store *Store) membershipDir(membership bungieAPI.MembershipPair) string {
+	return filepath.Join(store.dir, fmt.Sprintf("%v-%v", membership.MembershipType, filepath.Base(membership.MembershipId)))
+}
+
+func (store *Store) membershipLock(membership bungieAPI.MembershipPair) *sync.RWMutex {
+	lock, _ := store.locks.LoadOrStore(store.membershipDir(membership), &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+// monthFile is one month of a membership's snapshots.
+type monthFile struct {
+	path  string
+	month time.Time
+}
+
+// end is when the month's last snapshot could have been recorded.
+func (file monthFile) end() time.Time {
+	return file.month.AddDate(0, 1, 0)
+}
+
+// monthFiles lists the membership's snapshot files, oldest first.
+func (store *Store) monthFiles(membership bungieAPI.MembershipPair) ([]monthFile, error) {
+	dir := store.membershipDir(membership)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []monthFile{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		month, err := time.Parse(monthFileLayout, name)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, monthFile{path: filepath.Join(dir, entry.Name()), month: month})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].month.Before(files[j].month) })
+
+	return files, nil
+}
+
+// Append saves the snapshot as the latest for the membership, and deletes the membership's
+// months that have passed the retention.
+func (store *Store) Append(membership bungieAPI.MembershipPair, snapshot Snapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	lock := store.membershipLock(membership)
+	lock.Lock()
+	defer lock.Unlock()
+
+	dir := store.membershipDir(membership)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, snapshot.Time.UTC().Format(monthFileLayout)+".jsonl")
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(line)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return store.prune(membership, snapshot.Time.Add(-store.retention))
+}
+
+// prune deletes the membership's months that ended before the cutoff. The caller must hold the
+// membership's lock.
+func (store *Store) prune(membership bungieAPI.MembershipPair, cutoff time.Time) error {
+	files, err := store.monthFiles(membership)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !file.end().Before(cutoff) {
+			break
+		}
+
+		err := os.Remove(file.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read returns the membership's snapshots within the time range, oldest first. Only the months
+// overlapping the time range are read. Memberships that have never been recorded have no snapshots.
+func (store *Store) Read(membership bungieAPI.MembershipPair, timeRange backend.TimeRange) ([]Snapshot, error) {
+	lock := store.membershipLock(membership)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	snapshots := []Snapshot{}
+
+	files, err := store.monthFiles(membership)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.end().Before(timeRange.From) || file.month.After(timeRange.To) {
+			continue
+		}
+
+		snapshots, err = readMonthFile(file.path, membership, timeRange, snapshots)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return snapshots, nil
+}
+
+// readMonthFile appends the file's snapshots within the time range to snapshots.
+func readMonthFile(path string, membership bungieAPI.MembershipPair, timeRange backend.TimeRange, snapshots []Snapshot) ([]Snapshot, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_SNAPSHOT_SIZE)
+
+	for scanner.Scan() {
+		snapshot := Snapshot{}
+
+		// A crash mid-append can leave a partial line behind, which shouldn't hide every other snapshot
+		err := json.Unmarshal(scanner.Bytes(), &snapshot)
+		if err != nil {
+			backend.Logger.Warn("Skipping unreadable snapshot", "error", err, "membershipId", membership.MembershipId)
+			continue
+		}
+
+		if snapshot.Time.Before(timeRange.From) || snapshot.Time.After(timeRange.To) {
+			continue
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, scanner.Err()
+}
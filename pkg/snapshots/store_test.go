@@ -0,0 +1,82 @@
+package snapshots
+
+import (
+	bungieAPI "joshhunt-destiny-datasource/pkg/bungieApi"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestStoreReadsSnapshotsWithinTimeRange(t *testing.T) {
+	store := NewStore(t.TempDir(), 0)
+	membership := bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "100"}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for _, hoursAgo := range []int{48, 2, 1} {
+		err := store.Append(membership, Snapshot{Time: now.Add(-time.Hour * time.Duration(hoursAgo)), Values: map[string]float64{"Light (Hunter)": float64(hoursAgo)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A partial line from an interrupted append
+	monthPath := filepath.Join(store.membershipDir(membership), now.Add(-time.Hour).Format(monthFileLayout)+".jsonl")
+	file, err := os.OpenFile(monthPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(`{"time":`))
+	file.Close()
+
+	snapshots, err := store.Read(membership, backend.TimeRange{From: now.Add(-time.Hour * 24), To: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 2 || snapshots[0].Values["Light (Hunter)"] != 2 || snapshots[1].Values["Light (Hunter)"] != 1 {
+		t.Errorf("expected the two snapshots within the time range, oldest first, got %+v", snapshots)
+	}
+
+	otherSnapshots, err := store.Read(bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "200"}, backend.TimeRange{From: now.Add(-time.Hour * 24), To: now})
+	if err != nil || len(otherSnapshots) != 0 {
+		t.Errorf("expected no snapshots for an unrecorded membership, got %+v, %v", otherSnapshots, err)
+	}
+}
+
+func TestStoreDeletesMonthsPastRetention(t *testing.T) {
+	store := NewStore(t.TempDir(), time.Hour*24*60)
+	membership := bungieAPI.MembershipPair{MembershipType: 3, MembershipId: "100"}
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	for _, recorded := range []time.Time{now.AddDate(0, -4, 0), now.AddDate(0, -2, 0), now.AddDate(0, -1, 0), now} {
+		err := store.Append(membership, Snapshot{Time: recorded, Values: map[string]float64{"Guardian Rank": float64(recorded.Month())}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := store.monthFiles(membership)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// April ends within 60 days of the latest snapshot, so it's kept whole
+	months := []string{}
+	for _, file := range files {
+		months = append(months, file.month.Format(monthFileLayout))
+	}
+	if len(months) != 3 || months[0] != "2026-04" || months[2] != "2026-06" {
+		t.Errorf("expected the months within the retention, got %v", months)
+	}
+
+	snapshots, err := store.Read(membership, backend.TimeRange{From: now.AddDate(0, -1, -1), To: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Values["Guardian Rank"] != 5 || snapshots[1].Values["Guardian Rank"] != 6 {
+		t.Errorf("expected the snapshots across both months, oldest first, got %+v", snapshots)
+	}
+}
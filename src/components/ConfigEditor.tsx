@@ -1,10 +1,34 @@
-import React, { ChangeEvent } from 'react';
-import { Field, SecretInput } from '@grafana/ui';
-import { DataSourcePluginOptionsEditorProps } from '@grafana/data';
-import { MyDataSourceOptions, MySecureJsonData } from '../types';
+import { uniqBy } from 'lodash';
+import React, { ChangeEvent, useCallback } from 'react';
+import { AsyncSelect, Field, Input, MultiSelect, SecretInput, Select, Switch } from '@grafana/ui';
+import { DataSourcePluginOptionsEditorProps, SelectableValue } from '@grafana/data';
+import { getBackendSrv } from '@grafana/runtime';
+import {
+  LANGUAGE_OPTIONS,
+  Membership,
+  MyDataSourceOptions,
+  MySecureJsonData,
+  ProfileSearchResult,
+  SnapshotRecorderOptions,
+} from '../types';
 
 interface Props extends DataSourcePluginOptionsEditorProps<MyDataSourceOptions> {}
 
+const PROFILE_SEARCH_FALLBACK_OPTIONS: Array<SelectableValue<MyDataSourceOptions['profileSearchFallback']>> = [
+  { label: 'None', value: undefined },
+  {
+    label: 'Destiny Trials Report',
+    value: 'trialsReport',
+    description: "Search Destiny Trials Report when Bungie's search fails or finds nobody",
+  },
+];
+
+const SNAPSHOT_OPTIONS: Array<SelectableValue<NonNullable<SnapshotRecorderOptions['snapshots']>[number]>> = [
+  { label: 'Light', value: 'light', description: "Each character's power level" },
+  { label: 'Triumph score', value: 'triumphScore' },
+  { label: 'Progressions', value: 'progressions', description: 'Ranks, reputations and the season pass' },
+];
+
 export function ConfigEditor(props: Props) {
   const { onOptionsChange, options } = props;
 
@@ -32,18 +56,221 @@ export function ConfigEditor(props: Props) {
     });
   };
 
-  const { secureJsonFields } = options;
+  const updateJsonData = (jsonData: Partial<MyDataSourceOptions>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: {
+        ...options.jsonData,
+        ...jsonData,
+      },
+    });
+  };
+
+  const updateSnapshotRecorder = (snapshotRecorder: Partial<SnapshotRecorderOptions>) => {
+    updateJsonData({ snapshotRecorder: { ...options.jsonData.snapshotRecorder, ...snapshotRecorder } });
+  };
+
+  // Searches through the saved data source, as there's no data source instance to search with while editing it
+  const loadProfileSearchOptions = useCallback(
+    async (query: string): Promise<Array<SelectableValue<Membership>>> => {
+      let results = await getBackendSrv().post<ProfileSearchResult[]>(
+        `/api/datasources/uid/${options.uid}/resources/profile-search`,
+        { query }
+      );
+      // Players without cross save have a result for each platform they play on
+      results = uniqBy(results, (v) => `${v.membershipType}:${v.membershipId}`);
+
+      return results.map((v) => ({
+        label: v.bungieName,
+        description: v.membershipTypeName,
+        value: { membershipId: v.membershipId, membershipType: v.membershipType, bungieName: v.bungieName },
+      }));
+    },
+    [options.uid]
+  );
+
+  const { jsonData, secureJsonFields } = options;
   const secureJsonData = (options.secureJsonData || {}) as MySecureJsonData;
+  const snapshotRecorder = jsonData.snapshotRecorder ?? {};
+  const recorderProfiles = (snapshotRecorder.profiles ?? []).map((v) => ({ label: v.bungieName, value: v }));
 
   return (
-    <Field label="Bungie API Key" description="From Bungie.net developer portal">
-      <SecretInput
-        isConfigured={secureJsonFields && secureJsonFields.apiKey}
-        value={secureJsonData.apiKey || ''}
-        width={40}
-        onReset={onResetAPIKey}
-        onChange={onAPIKeyChange}
-      />
-    </Field>
+    <>
+      <Field label="Bungie API Key" description="From Bungie.net developer portal">
+        <SecretInput
+          isConfigured={secureJsonFields && secureJsonFields.apiKey}
+          value={secureJsonData.apiKey || ''}
+          width={40}
+          onReset={onResetAPIKey}
+          onChange={onAPIKeyChange}
+        />
+      </Field>
+
+      <Field label="Language" description="Language of activity, item and stat names. Defaults to English">
+        <Select
+          width={40}
+          options={LANGUAGE_OPTIONS}
+          value={jsonData.language ?? null}
+          onChange={(change: SelectableValue<string> | null) => updateJsonData({ language: change?.value })}
+          isClearable
+          placeholder="English"
+        />
+      </Field>
+
+      <Field label="Player search fallback" description="Another service to search for players with">
+        <Select
+          width={40}
+          options={PROFILE_SEARCH_FALLBACK_OPTIONS}
+          value={jsonData.profileSearchFallback}
+          onChange={(change) => updateJsonData({ profileSearchFallback: change.value })}
+        />
+      </Field>
+
+      <h3 className="page-heading">Connection</h3>
+
+      <Field label="Bungie.net URL" description="Host for Bungie API requests. Defaults to https://www.bungie.net">
+        <Input
+          width={40}
+          value={jsonData.baseUrl ?? ''}
+          placeholder="https://www.bungie.net"
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateJsonData({ baseUrl: ev.currentTarget.value || undefined })
+          }
+        />
+      </Field>
+
+      <Field
+        label="Stats URL"
+        description="Host for stats requests, such as PGCRs. Defaults to the Bungie.net URL when that's set, otherwise https://stats.bungie.net"
+      >
+        <Input
+          width={40}
+          value={jsonData.statsBaseUrl ?? ''}
+          placeholder="https://stats.bungie.net"
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateJsonData({ statsBaseUrl: ev.currentTarget.value || undefined })
+          }
+        />
+      </Field>
+
+      <Field label="Timeout" description="Seconds to wait for each Bungie API request. Defaults to 15">
+        <Input
+          type="number"
+          width={40}
+          min={1}
+          value={jsonData.timeoutSeconds ?? ''}
+          placeholder="15"
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateJsonData({
+              timeoutSeconds: ev.currentTarget.value ? parseInt(ev.currentTarget.value, 10) : undefined,
+            })
+          }
+        />
+      </Field>
+
+      <Field label="Proxy URL" optional description="HTTP proxy to send Bungie API requests through">
+        <Input
+          width={40}
+          value={jsonData.proxyUrl ?? ''}
+          placeholder="http://proxy.example.com:8080"
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateJsonData({ proxyUrl: ev.currentTarget.value || undefined })
+          }
+        />
+      </Field>
+
+      <Field
+        label="Definition cache directory"
+        description="Where downloaded Destiny definitions are kept between restarts. Defaults to the user cache directory"
+      >
+        <Input
+          width={40}
+          value={jsonData.cacheDirectory ?? ''}
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateJsonData({ cacheDirectory: ev.currentTarget.value || undefined })
+          }
+        />
+      </Field>
+
+      <h3 className="page-heading">Snapshot recorder</h3>
+
+      <Field
+        label="Record snapshots"
+        description="Periodically record values Bungie only reports the current state of, for the Snapshots query"
+      >
+        <Switch
+          value={snapshotRecorder.enabled ?? false}
+          onChange={(ev) => updateSnapshotRecorder({ enabled: ev.currentTarget.checked })}
+        />
+      </Field>
+
+      <Field label="Players" description="Save the data source with an API key before searching">
+        <AsyncSelect
+          isMulti
+          width={40}
+          loadOptions={loadProfileSearchOptions}
+          value={recorderProfiles}
+          defaultOptions={recorderProfiles}
+          onChange={(change: Array<SelectableValue<Membership>>) =>
+            updateSnapshotRecorder({ profiles: change.map((v) => v.value!) })
+          }
+          noOptionsMessage="Type to search for player"
+          loadingMessage="Searching..."
+        />
+      </Field>
+
+      <Field label="Snapshots" description="Defaults to all of them">
+        <MultiSelect
+          width={40}
+          options={SNAPSHOT_OPTIONS}
+          value={snapshotRecorder.snapshots ?? []}
+          onChange={(change) => updateSnapshotRecorder({ snapshots: change.map((v) => v.value!) })}
+          placeholder="All"
+        />
+      </Field>
+
+      <Field label="Interval" description="Minutes between snapshots. Defaults to 60, and can't be less than 15">
+        <Input
+          type="number"
+          width={40}
+          min={15}
+          value={snapshotRecorder.intervalMinutes ?? ''}
+          placeholder="60"
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateSnapshotRecorder({
+              intervalMinutes: ev.currentTarget.value ? parseInt(ev.currentTarget.value, 10) : undefined,
+            })
+          }
+        />
+      </Field>
+
+      <Field label="Retention" description="Days snapshots are kept for. Defaults to 365">
+        <Input
+          type="number"
+          width={40}
+          min={1}
+          value={snapshotRecorder.retentionDays ?? ''}
+          placeholder="365"
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateSnapshotRecorder({
+              retentionDays: ev.currentTarget.value ? parseInt(ev.currentTarget.value, 10) : undefined,
+            })
+          }
+        />
+      </Field>
+
+      <Field
+        label="Snapshot directory"
+        description="Where the plugin stores snapshots. Defaults to a directory for this data source in the user config directory"
+      >
+        <Input
+          width={40}
+          value={jsonData.snapshotDirectory ?? ''}
+          onChange={(ev: ChangeEvent<HTMLInputElement>) =>
+            updateJsonData({ snapshotDirectory: ev.currentTarget.value || undefined })
+          }
+        />
+      </Field>
+    </>
   );
 }
@@ -1,31 +1,105 @@
 import { uniqBy } from 'lodash';
 
-import React, { useCallback, useEffect, useMemo, useState } from 'react';
-import { AsyncSelect, Select } from '@grafana/ui';
+import React, { ChangeEvent, useCallback, useEffect, useMemo, useRef, useState } from 'react';
+import { AsyncSelect, Input, MultiSelect, Select } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { DataSource } from '../datasource';
 import {
   CharacterItem as ListCharactersItem,
+  ClanSearchResult,
+  LANGUAGE_OPTIONS,
+  LinkedMembership,
   Membership,
+  MetricItem,
   MyDataSourceOptions,
   MyQuery,
-  TrialsReportSearchResult,
+  ProfileSearchResult,
+  QUERY_TYPE_OPTIONS,
+  QueryProfile,
+  QueryType,
 } from '../types';
 import { EditorField, EditorRow, EditorRows, EditorSwitch } from '@grafana/plugin-ui';
 
 type Props = QueryEditorProps<DataSource, MyQuery, MyDataSourceOptions>;
 
+const SPLIT_BY_OPTIONS: Array<SelectableValue<MyQuery['splitBy']>> = [
+  { label: 'None', value: '' },
+  { label: 'Activity mode', value: 'activityMode' },
+  { label: 'Character', value: 'character' },
+];
+
+const REDUCE_OPTIONS: Array<SelectableValue<MyQuery['reduce']>> = [
+  { label: 'None', value: '' },
+  { label: 'Latest', value: 'latest', description: 'Only the most recent activity' },
+  { label: 'Total', value: 'total', description: 'Totals across the time range' },
+];
+
+const PERIOD_TYPE_OPTIONS: Array<SelectableValue<MyQuery['periodType']>> = [
+  { label: 'All time', value: 'allTime' },
+  { label: 'Daily', value: 'daily' },
+];
+
+const WEAPON_SOURCE_OPTIONS: Array<SelectableValue<MyQuery['weaponSource']>> = [
+  { label: 'Lifetime', value: 'lifetime' },
+  { label: 'Time range', value: 'timeRange', description: 'From the PGCRs of activities in the time range' },
+];
+
+const STAT_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'All', value: 'all' },
+  { label: 'Kills', value: 'kills' },
+  { label: 'Deaths', value: 'deaths' },
+  { label: 'Assists', value: 'assists' },
+  { label: 'K/D', value: 'killsDeathsRatio' },
+  { label: 'KDA', value: 'killsDeathsAssists' },
+  { label: 'Efficiency', value: 'efficiency' },
+  { label: 'Score', value: 'score' },
+  { label: 'Opponents defeated', value: 'opponentsDefeated' },
+  { label: 'Precision kills', value: 'precisionKills' },
+];
+
+// Query types that can run without a player, given their own inputs
+const QUERY_TYPES_WITHOUT_PROFILE: QueryType[] = ['clanRoster', 'postGameCarnageReport'];
+
+const QUERY_TYPES_WITH_ACTIVITY_MODE: QueryType[] = [
+  'activityHistory',
+  'postGameCarnageReport',
+  'activityTimeSeries',
+  'weaponUsage',
+  'clanRoster',
+];
+
+function toProfileOptions(profiles: Membership[]): Array<SelectableValue<Membership>> {
+  return profiles.map((v) => ({ label: v.bungieName, value: v }));
+}
+
+function membershipKey(membership: Membership): string {
+  return `${membership.membershipType}:${membership.membershipId}`;
+}
+
 export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props) {
   const [characterOptions, setCharacterOptions] = useState<ListCharactersItem[]>([]);
   const [activityModes, setActivityModes] = useState<SelectableValue[]>([]);
+  const [metricOptions, setMetricOptions] = useState<Array<SelectableValue<number>>>([]);
+  const [linkedMemberships, setLinkedMemberships] = useState<LinkedMembership[]>([]);
+  // Characters of each compared player, by membership key
+  const [profileCharacterOptions, setProfileCharacterOptions] = useState<Record<string, ListCharactersItem[]>>({});
+  const requestedProfileCharacters = useRef(new Set<string>());
   const [isSearching, setIsSearching] = useState(false);
 
+  const queryType = query.queryType ?? 'activityHistory';
+
   const updateQuery = useCallback(
     (update: Partial<MyQuery>) => {
       const newQuery = { ...query, ...update };
       onChange(newQuery);
 
-      if (newQuery.profile) {
+      const newQueryType = newQuery.queryType ?? 'activityHistory';
+      const hasProfile = !!newQuery.profile || !!newQuery.profiles?.length;
+      const canRunWithoutProfile =
+        (newQueryType === 'clanRoster' && !!newQuery.clanId) ||
+        (newQueryType === 'postGameCarnageReport' && !!newQuery.instanceIds?.length);
+
+      if (hasProfile || canRunWithoutProfile) {
         onRunQuery();
       }
     },
@@ -45,6 +119,37 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
     });
   }, [datasource, query.profile]);
 
+  /**
+   * Request character options for compared players that haven't been requested yet
+   */
+  useEffect(() => {
+    for (const profile of query.profiles ?? []) {
+      const key = membershipKey(profile);
+      if (requestedProfileCharacters.current.has(key)) {
+        continue;
+      }
+      requestedProfileCharacters.current.add(key);
+
+      datasource.postResource<ListCharactersItem[]>('list-characters', profile).then((characters) => {
+        setProfileCharacterOptions((existing) => ({ ...existing, [key]: characters }));
+      });
+    }
+  }, [datasource, query.profiles]);
+
+  /**
+   * Request the player's linked memberships, to show what all linked memberships includes
+   */
+  useEffect(() => {
+    if (!query.profile || !query.allLinkedMemberships) {
+      setLinkedMemberships([]);
+      return;
+    }
+
+    datasource.postResource<LinkedMembership[]>('linked-memberships', query.profile).then((memberships) => {
+      setLinkedMemberships(memberships);
+    });
+  }, [datasource, query.profile, query.allLinkedMemberships]);
+
   /**
    * Request activity modes on load
    */
@@ -54,6 +159,25 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
     });
   }, [datasource, query.profile]);
 
+  /**
+   * Request metrics when they're needed, as the list is large
+   */
+  useEffect(() => {
+    if (queryType !== 'metrics') {
+      return;
+    }
+
+    datasource.getResource<MetricItem[]>('list-metrics').then((metrics) => {
+      setMetricOptions(
+        metrics.map((v) => ({
+          label: v.category ? `${v.category}: ${v.label}` : v.label,
+          value: v.value,
+          description: v.description,
+        }))
+      );
+    });
+  }, [datasource, queryType]);
+
   /**
    * Ensure character list contains only valid characters
    */
@@ -74,29 +198,41 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
 
   const loadProfileSearchOptions = useCallback(
     async (query: string): Promise<Array<SelectableValue<Membership>>> => {
-      let results = await datasource.postResource<TrialsReportSearchResult[]>('profile-search', { query });
-      results = uniqBy(results, (v) => v.bungieName);
-
-      return results.map((v) => {
-        let membershipId = v.membershipId;
-        let membershipType = v.membershipType;
-
-        if (v.crossSaveOverride && v.crossSaveOverride.membershipType > 0) {
-          membershipId = v.crossSaveOverride.membershipId;
-          membershipType = v.crossSaveOverride.membershipType;
-        }
-
-        return {
-          label: v.bungieName,
-          value: { membershipId, membershipType, bungieName: v.bungieName },
-        };
-      });
+      let results = await datasource.postResource<ProfileSearchResult[]>('profile-search', { query });
+      // Players without cross save have a result for each platform they play on
+      results = uniqBy(results, (v) => `${v.membershipType}:${v.membershipId}`);
+
+      return results.map((v) => ({
+        label: v.bungieName,
+        description: v.membershipTypeName,
+        value: { membershipId: v.membershipId, membershipType: v.membershipType, bungieName: v.bungieName },
+      }));
+    },
+    [datasource]
+  );
+
+  const loadClanSearchOptions = useCallback(
+    async (query: string): Promise<Array<SelectableValue<string>>> => {
+      const results = await datasource.postResource<ClanSearchResult[]>('clan-search', { query });
+
+      return results.map((v) => ({
+        label: v.callsign ? `${v.name} [${v.callsign}]` : v.name,
+        value: v.groupId,
+        description: `${v.memberCount} members`,
+      }));
     },
     [datasource]
   );
 
   const handleSearchInputChange = useCallback((searchValue: string) => setIsSearching(!!searchValue), []);
 
+  const onQueryTypeChange = useCallback(
+    (change: SelectableValue<QueryType>) => {
+      updateQuery({ queryType: change.value });
+    },
+    [updateQuery]
+  );
+
   const onMembershipChange = useCallback(
     (change: SelectableValue<Membership>) => {
       updateQuery({ profile: change.value });
@@ -104,6 +240,28 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
     [updateQuery]
   );
 
+  const onProfilesChange = useCallback(
+    (change: Array<SelectableValue<Membership>> | null) => {
+      // Keep the characters already selected for players that are still being compared
+      const existingProfiles = new Map((query.profiles ?? []).map((v) => [membershipKey(v), v]));
+      const profiles = (change ?? []).flatMap((v) =>
+        v.value ? [existingProfiles.get(membershipKey(v.value)) ?? v.value] : []
+      );
+      updateQuery({ profiles });
+    },
+    [query.profiles, updateQuery]
+  );
+
+  const onProfileCharactersChange = useCallback(
+    (profile: QueryProfile, characters: string[]) => {
+      const profiles = (query.profiles ?? []).map((v) =>
+        membershipKey(v) === membershipKey(profile) ? { ...v, characters } : v
+      );
+      updateQuery({ profiles });
+    },
+    [query.profiles, updateQuery]
+  );
+
   const onActivityModeChange = useCallback(
     (change: SelectableValue | undefined) => {
       updateQuery({ activityMode: change?.value });
@@ -131,6 +289,25 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
     [characterOptions, query.characters, updateQuery]
   );
 
+  const onInstanceIdsBlur = useCallback(
+    (ev: ChangeEvent<HTMLInputElement>) => {
+      const instanceIds = ev.currentTarget.value
+        .split(/[\s,]+/)
+        .map((v) => v.trim())
+        .filter(Boolean);
+      updateQuery({ instanceIds });
+    },
+    [updateQuery]
+  );
+
+  const onPresentationNodeHashBlur = useCallback(
+    (ev: ChangeEvent<HTMLInputElement>) => {
+      const hash = parseInt(ev.currentTarget.value, 10);
+      updateQuery({ presentationNodeHash: Number.isNaN(hash) ? undefined : hash });
+    },
+    [updateQuery]
+  );
+
   const profileValue = useMemo(() => {
     if (!query.profile) {
       return [];
@@ -144,6 +321,10 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
     ];
   }, [query.profile]);
 
+  const profilesValue = useMemo(() => toProfileOptions(query.profiles ?? []), [query.profiles]);
+
+  const clanValue = useMemo(() => (query.clanId ? { label: query.clanId, value: query.clanId } : null), [query.clanId]);
+
   const charactersToRender = useMemo(() => {
     return characterOptions.length
       ? characterOptions
@@ -154,46 +335,302 @@ export function QueryEditor({ query, onChange, onRunQuery, datasource }: Props)
         ];
   }, [characterOptions]);
 
+  // Memberships overridden by cross save have no Destiny data of their own, so queries skip them
+  const linkedMembershipsDescription = useMemo(() => {
+    const activeMemberships = linkedMemberships.filter((v) => !v.isOverridden);
+    if (!activeMemberships.length) {
+      return undefined;
+    }
+
+    return `Includes ${activeMemberships.map((v) => `${v.membershipTypeName} (${v.displayName})`).join(', ')}`;
+  }, [linkedMemberships]);
+
+  const showsProfile = queryType !== 'clanRoster';
+  const showsCharacters = showsProfile && !query.profiles?.length;
+
   return (
     <EditorRows>
       <EditorRow>
-        <EditorField label="Player">
-          <AsyncSelect
-            width={26}
-            loadOptions={loadProfileSearchOptions}
-            onChange={onMembershipChange}
-            value={profileValue[0]}
-            defaultOptions={profileValue}
-            onInputChange={handleSearchInputChange}
-            noOptionsMessage={isSearching ? 'No players found' : 'Type to search for player'}
-            loadingMessage="Searching..."
-          />
+        <EditorField label="Query type">
+          <Select width={30} options={QUERY_TYPE_OPTIONS} value={queryType} onChange={onQueryTypeChange} />
         </EditorField>
 
-        {charactersToRender.map((v) => {
-          return (
-            <EditorField key={v.characterId} width={8} label={v.description}>
-              <>
-                <EditorSwitch
-                  disabled={v.isPlaceholder}
-                  value={query.characters?.includes(v.characterId)}
-                  onChange={(ev) => !v.isPlaceholder && onCharacterToggled(v.characterId, ev.currentTarget.checked)}
-                />
-              </>
-            </EditorField>
-          );
-        })}
+        {QUERY_TYPES_WITH_ACTIVITY_MODE.includes(queryType) && (
+          <EditorField label="Activity mode">
+            <Select
+              value={query.activityMode}
+              width={30}
+              options={activityModes}
+              onChange={onActivityModeChange}
+              isClearable
+            />
+          </EditorField>
+        )}
 
-        <EditorField label="Activity mode">
+        <EditorField label="Language" optional tooltip="Defaults to the data source's language">
           <Select
-            value={query.activityMode}
-            width={30}
-            options={activityModes}
-            onChange={onActivityModeChange}
+            width={20}
+            options={LANGUAGE_OPTIONS}
+            value={query.language ?? null}
+            onChange={(change) => updateQuery({ language: change?.value })}
             isClearable
           />
         </EditorField>
       </EditorRow>
+
+      {showsProfile && (
+        <EditorRow>
+          <EditorField
+            label="Player"
+            optional={QUERY_TYPES_WITHOUT_PROFILE.includes(queryType)}
+            tooltip="Ignored when comparing players"
+          >
+            <AsyncSelect
+              width={26}
+              loadOptions={loadProfileSearchOptions}
+              onChange={onMembershipChange}
+              value={profileValue[0]}
+              defaultOptions={profileValue}
+              onInputChange={handleSearchInputChange}
+              noOptionsMessage={isSearching ? 'No players found' : 'Type to search for player'}
+              loadingMessage="Searching..."
+            />
+          </EditorField>
+
+          {showsCharacters &&
+            charactersToRender.map((v) => {
+              return (
+                <EditorField key={v.characterId} width={8} label={v.description}>
+                  <>
+                    <EditorSwitch
+                      disabled={v.isPlaceholder}
+                      value={query.characters?.includes(v.characterId)}
+                      onChange={(ev) => !v.isPlaceholder && onCharacterToggled(v.characterId, ev.currentTarget.checked)}
+                    />
+                  </>
+                </EditorField>
+              );
+            })}
+
+          <EditorField label="Compare players" optional>
+            <AsyncSelect
+              isMulti
+              width={40}
+              loadOptions={loadProfileSearchOptions}
+              onChange={onProfilesChange}
+              value={profilesValue}
+              defaultOptions={profilesValue}
+              noOptionsMessage="Type to search for player"
+              loadingMessage="Searching..."
+            />
+          </EditorField>
+
+          <EditorField
+            label="All linked memberships"
+            tooltip="Include every platform linked to the Bungie account"
+            description={linkedMembershipsDescription}
+          >
+            <EditorSwitch
+              value={query.allLinkedMemberships ?? false}
+              onChange={(ev) => updateQuery({ allLinkedMemberships: ev.currentTarget.checked })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {showsProfile && !!query.profiles?.length && (
+        <EditorRow>
+          {query.profiles.map((profile) => (
+            <EditorField
+              key={membershipKey(profile)}
+              label={`${profile.bungieName} characters`}
+              optional
+              tooltip="Defaults to all of the player's characters. Ignored with all linked memberships"
+            >
+              <MultiSelect
+                width={30}
+                options={(profileCharacterOptions[membershipKey(profile)] ?? []).map((v) => ({
+                  label: v.description,
+                  value: v.characterId,
+                }))}
+                value={profile.characters ?? []}
+                onChange={(change) =>
+                  onProfileCharactersChange(profile, change.flatMap((v) => (v.value ? [v.value] : [])))
+                }
+                placeholder="All"
+                disabled={query.allLinkedMemberships}
+              />
+            </EditorField>
+          ))}
+        </EditorRow>
+      )}
+
+      {queryType === 'activityHistory' && (
+        <EditorRow>
+          <EditorField label="Stats" optional tooltip="Activity stat keys to add as columns">
+            <MultiSelect
+              width={40}
+              allowCustomValue
+              options={STAT_OPTIONS}
+              value={query.stats ?? []}
+              onChange={(change) => updateQuery({ stats: change.flatMap((v) => (v.value ? [v.value] : [])) })}
+            />
+          </EditorField>
+          <EditorField label="Reduce">
+            <Select
+              width={20}
+              options={REDUCE_OPTIONS}
+              value={query.reduce ?? ''}
+              onChange={(change) => updateQuery({ reduce: change.value })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {queryType === 'postGameCarnageReport' && (
+        <EditorRow>
+          <EditorField label="PGCR IDs" optional tooltip="Leave empty for every activity of the player in the time range">
+            <Input
+              width={40}
+              placeholder="Comma separated PGCR IDs"
+              defaultValue={(query.instanceIds ?? []).join(', ')}
+              onBlur={onInstanceIdsBlur}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {(queryType === 'activityTimeSeries' || (queryType === 'weaponUsage' && query.weaponSource === 'timeRange')) && (
+        <EditorRow>
+          <EditorField label="Bucket size" optional tooltip="Defaults to the panel's interval">
+            <Input
+              width={12}
+              placeholder="auto"
+              defaultValue={query.bucketSize}
+              onBlur={(ev) => updateQuery({ bucketSize: ev.currentTarget.value })}
+            />
+          </EditorField>
+          {queryType === 'activityTimeSeries' && (
+            <EditorField label="Split by">
+              <Select
+                width={20}
+                options={SPLIT_BY_OPTIONS}
+                value={query.splitBy ?? ''}
+                onChange={(change) => updateQuery({ splitBy: change.value })}
+              />
+            </EditorField>
+          )}
+        </EditorRow>
+      )}
+
+      {queryType === 'aggregateStats' && (
+        <EditorRow>
+          <EditorField label="Period">
+            <Select
+              width={20}
+              options={PERIOD_TYPE_OPTIONS}
+              value={query.periodType ?? 'allTime'}
+              onChange={(change) => updateQuery({ periodType: change.value })}
+            />
+          </EditorField>
+          <EditorField label="Modes" optional tooltip="Defaults to PvE, PvP, raids, strikes and Gambit">
+            <MultiSelect
+              width={40}
+              options={activityModes}
+              value={query.modes ?? []}
+              onChange={(change) => updateQuery({ modes: change.map((v) => v.value) })}
+            />
+          </EditorField>
+          <EditorField label="Stats" optional>
+            <MultiSelect
+              width={40}
+              allowCustomValue
+              options={STAT_OPTIONS}
+              value={query.stats ?? []}
+              onChange={(change) => updateQuery({ stats: change.flatMap((v) => (v.value ? [v.value] : [])) })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {queryType === 'weaponUsage' && (
+        <EditorRow>
+          <EditorField label="Source">
+            <Select
+              width={20}
+              options={WEAPON_SOURCE_OPTIONS}
+              value={query.weaponSource ?? 'lifetime'}
+              onChange={(change) => updateQuery({ weaponSource: change.value })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {queryType === 'clanRoster' && (
+        <EditorRow>
+          <EditorField label="Clan">
+            <AsyncSelect
+              width={40}
+              loadOptions={loadClanSearchOptions}
+              onChange={(change: SelectableValue<string>) => updateQuery({ clanId: change.value })}
+              value={clanValue}
+              defaultOptions={clanValue ? [clanValue] : []}
+              noOptionsMessage="Type to search for a clan name or ID"
+              loadingMessage="Searching..."
+            />
+          </EditorField>
+          <EditorField label="Include activities" tooltip="Also return every member's activity history">
+            <EditorSwitch
+              value={query.includeActivities ?? false}
+              onChange={(ev) => updateQuery({ includeActivities: ev.currentTarget.checked })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {(queryType === 'triumphs' || queryType === 'collectibles') && (
+        <EditorRow>
+          <EditorField
+            label="Presentation node hash"
+            optional
+            tooltip={queryType === 'triumphs' ? 'Defaults to every seal' : 'Defaults to every collection'}
+          >
+            <Input
+              width={20}
+              type="number"
+              defaultValue={query.presentationNodeHash}
+              onBlur={onPresentationNodeHashBlur}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {queryType === 'snapshots' && (
+        <EditorRow>
+          <EditorField label="Series" optional tooltip="Names of recorded series, such as Light (Hunter). Defaults to all of them">
+            <MultiSelect
+              width={40}
+              allowCustomValue
+              options={(query.snapshotSeries ?? []).map((v) => ({ label: v, value: v }))}
+              value={query.snapshotSeries ?? []}
+              onChange={(change) => updateQuery({ snapshotSeries: change.flatMap((v) => (v.value ? [v.value] : [])) })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
+
+      {queryType === 'metrics' && (
+        <EditorRow>
+          <EditorField label="Metrics" optional tooltip="Defaults to every visible metric">
+            <MultiSelect
+              width={60}
+              options={metricOptions}
+              value={query.metricHashes ?? []}
+              onChange={(change) => updateQuery({ metricHashes: change.flatMap((v) => (v.value ? [v.value] : [])) })}
+            />
+          </EditorField>
+        </EditorRow>
+      )}
     </EditorRows>
   );
 }
@@ -1,4 +1,4 @@
-import { DataQuery, DataSourceJsonData } from '@grafana/data';
+import { DataQuery, DataSourceJsonData, SelectableValue } from '@grafana/data';
 
 export interface Membership {
   membershipType: number;
@@ -6,10 +6,77 @@ export interface Membership {
   bungieName: string;
 }
 
+export type QueryType =
+  | 'activityHistory'
+  | 'postGameCarnageReport'
+  | 'activityTimeSeries'
+  | 'aggregateStats'
+  | 'weaponUsage'
+  | 'clanRoster'
+  | 'profileSnapshot'
+  | 'triumphs'
+  | 'collectibles'
+  | 'progressions'
+  | 'snapshots'
+  | 'metrics';
+
+export const QUERY_TYPE_OPTIONS: Array<SelectableValue<QueryType>> = [
+  { label: 'Activity history', value: 'activityHistory' },
+  { label: 'Post Game Carnage Reports', value: 'postGameCarnageReport' },
+  { label: 'Activity time series', value: 'activityTimeSeries' },
+  { label: 'Aggregate stats', value: 'aggregateStats' },
+  { label: 'Weapon usage', value: 'weaponUsage' },
+  { label: 'Clan roster', value: 'clanRoster' },
+  { label: 'Profile snapshot', value: 'profileSnapshot' },
+  { label: 'Triumphs', value: 'triumphs' },
+  { label: 'Collectibles', value: 'collectibles' },
+  { label: 'Progressions', value: 'progressions' },
+  { label: 'Recorded snapshots', value: 'snapshots' },
+  { label: 'Metrics', value: 'metrics' },
+];
+
+// Mirrors LOCALES in pkg/bungieApi/definitions.go
+export const LANGUAGE_OPTIONS: Array<SelectableValue<string>> = [
+  { label: 'English', value: 'en' },
+  { label: 'French', value: 'fr' },
+  { label: 'Spanish', value: 'es' },
+  { label: 'Spanish (Mexico)', value: 'es-mx' },
+  { label: 'German', value: 'de' },
+  { label: 'Italian', value: 'it' },
+  { label: 'Japanese', value: 'ja' },
+  { label: 'Portuguese (Brazil)', value: 'pt-br' },
+  { label: 'Russian', value: 'ru' },
+  { label: 'Polish', value: 'pl' },
+  { label: 'Korean', value: 'ko' },
+  { label: 'Chinese (Traditional)', value: 'zh-cht' },
+  { label: 'Chinese (Simplified)', value: 'zh-chs' },
+];
+
 export interface MyQuery extends DataQuery {
+  queryType?: QueryType;
   profile?: Membership;
   characters?: string[];
   activityMode?: number;
+  instanceIds?: string[];
+  language?: string;
+  bucketSize?: string;
+  splitBy?: '' | 'activityMode' | 'character';
+  reduce?: '' | 'latest' | 'total';
+  stats?: string[];
+  periodType?: 'allTime' | 'daily';
+  modes?: number[];
+  weaponSource?: 'lifetime' | 'timeRange';
+  allLinkedMemberships?: boolean;
+  profiles?: QueryProfile[];
+  clanId?: string;
+  includeActivities?: boolean;
+  presentationNodeHash?: number;
+  snapshotSeries?: string[];
+  metricHashes?: number[];
+}
+
+export interface QueryProfile extends Membership {
+  characters?: string[];
 }
 
 export const DEFAULT_QUERY: Partial<MyQuery> = {};
@@ -19,6 +86,23 @@ export const DEFAULT_QUERY: Partial<MyQuery> = {};
  */
 export interface MyDataSourceOptions extends DataSourceJsonData {
   path?: string;
+  baseUrl?: string;
+  statsBaseUrl?: string;
+  timeoutSeconds?: number;
+  proxyUrl?: string;
+  cacheDirectory?: string;
+  language?: string;
+  profileSearchFallback?: 'trialsReport';
+  snapshotDirectory?: string;
+  snapshotRecorder?: SnapshotRecorderOptions;
+}
+
+export interface SnapshotRecorderOptions {
+  enabled?: boolean;
+  intervalMinutes?: number;
+  retentionDays?: number;
+  profiles?: Membership[];
+  snapshots?: Array<'light' | 'triumphScore' | 'progressions'>;
 }
 
 /**
@@ -28,21 +112,29 @@ export interface MySecureJsonData {
   apiKey?: string;
 }
 
-export interface TrialsReportSearchResult {
-  bnetId: number;
+export interface ProfileSearchResult {
   bungieName: string;
   displayName: string;
   membershipId: string;
   membershipType: number;
-  crossSaveOverride: CrossSaveOverride;
-  emblemHash: number;
-  lastPlayed: Date;
-  score: number;
+  membershipTypeName: string;
 }
 
-export interface CrossSaveOverride {
+export interface LinkedMembership {
   membershipId: string;
   membershipType: number;
+  membershipTypeName: string;
+  displayName: string;
+  isCrossSavePrimary: boolean;
+  isOverridden: boolean;
+  dateLastPlayed: string;
+}
+
+export interface ClanSearchResult {
+  groupId: string;
+  name: string;
+  callsign: string;
+  memberCount: number;
 }
 
 export interface CharacterItem {
@@ -50,3 +142,11 @@ export interface CharacterItem {
   description: string;
   isPlaceholder?: boolean;
 }
+
+export interface MetricItem {
+  value: number;
+  label: string;
+  description: string;
+  category: string;
+  traits: string[];
+}